@@ -0,0 +1,83 @@
+/// <reference path="../.sst/platform/config.d.ts" />
+
+export function createEvents({ fn }: { fn: sst.aws.Function }) {
+  const identity = aws.getCallerIdentityOutput();
+
+  const rule = new aws.cloudwatch.EventRule("security-group-manager-changes", {
+    name: "security-group-manager-changes",
+    description: "Remediate security group changes recorded by CloudTrail",
+    eventPattern: $jsonStringify({
+      source: ["aws.ec2"],
+      "detail-type": ["AWS API Call via CloudTrail"],
+      detail: {
+        eventSource: ["ec2.amazonaws.com"],
+        // changes made by the Lambda itself do not invoke it again
+        userIdentity: {
+          arn: [
+            {
+              "anything-but": {
+                prefix: $interpolate`arn:aws:sts::${identity.accountId}:assumed-role/${fn.nodes.role.name}/`,
+              },
+            },
+          ],
+        },
+        $or: [
+          {
+            eventName: [
+              "AuthorizeSecurityGroupIngress",
+              "RevokeSecurityGroupIngress",
+              "ModifySecurityGroupRules",
+            ],
+          },
+          {
+            eventName: ["CreateTags"],
+            requestParameters: {
+              resourcesSet: {
+                items: {
+                  resourceId: [{ prefix: "sg-" }],
+                },
+              },
+            },
+          },
+        ],
+      },
+    }),
+  });
+
+  new aws.cloudwatch.EventTarget("security-group-manager-changes", {
+    rule: rule.name,
+    arn: fn.arn,
+  });
+
+  new aws.lambda.Permission("security-group-manager-changes", {
+    action: "lambda:InvokeFunction",
+    function: fn.name,
+    principal: "events.amazonaws.com",
+    sourceArn: rule.arn,
+  });
+
+  const updates = new aws.cloudwatch.EventRule("security-group-manager-updates", {
+    name: "security-group-manager-updates",
+    description: "Reconcile on updates of the whitelist secret",
+    eventPattern: JSON.stringify({
+      source: ["aws.secretsmanager"],
+      "detail-type": ["AWS API Call via CloudTrail"],
+      detail: {
+        eventSource: ["secretsmanager.amazonaws.com"],
+        eventName: ["PutSecretValue", "UpdateSecret"],
+      },
+    }),
+  });
+
+  new aws.cloudwatch.EventTarget("security-group-manager-updates", {
+    rule: updates.name,
+    arn: fn.arn,
+  });
+
+  new aws.lambda.Permission("security-group-manager-updates", {
+    action: "lambda:InvokeFunction",
+    function: fn.name,
+    principal: "events.amazonaws.com",
+    sourceArn: updates.arn,
+  });
+}
@@ -2,10 +2,61 @@
 
 import { REPO_URL } from "./constants";
 
-export function createFunction() {
+export interface FunctionProps {
+  // SSM parameters of CONFIG_SOURCE=ssm:<name>, read in SECRET_REGION
+  parameters?: string[];
+  // ARNs of customer managed KMS keys encrypting SecureString parameters
+  keys?: string[];
+  // S3 buckets of configuration sources and of snapshots, restores and compliance reports
+  buckets?: string[];
+  // DynamoDB tables of AUDIT_SINK=dynamodb:<table>, written in OPERATIONAL_REGION
+  tables?: string[];
+}
+
+export function createFunction({ parameters = [], keys = [], buckets = [], tables = [] }: FunctionProps = {}) {
   const identity = aws.getCallerIdentityOutput();
   const region = aws.getRegionOutput();
 
+  // grants for the optional configuration sources, snapshots and audit sinks
+  const optional = [
+    ...(parameters.length > 0
+      ? [
+          {
+            actions: ["ssm:GetParameter"],
+            resources: parameters.map(
+              (name) => $interpolate`arn:aws:ssm:us-east-1:${identity.accountId}:parameter/${name.replace(/^\//, "")}`,
+            ),
+          },
+        ]
+      : []),
+    ...(keys.length > 0
+      ? [
+          {
+            actions: ["kms:Decrypt"],
+            resources: keys,
+          },
+        ]
+      : []),
+    ...(buckets.length > 0
+      ? [
+          {
+            actions: ["s3:GetObject", "s3:PutObject"],
+            resources: buckets.map((bucket) => `arn:aws:s3:::${bucket}/*`),
+          },
+        ]
+      : []),
+    ...(tables.length > 0
+      ? [
+          {
+            actions: ["dynamodb:BatchWriteItem"],
+            resources: tables.map(
+              (table) => $interpolate`arn:aws:dynamodb:${region.name}:${identity.accountId}:table/${table}`,
+            ),
+          },
+        ]
+      : []),
+  ];
+
   const fn = new sst.aws.Function("security-group-manager", {
     handler: ".",
     runtime: "go" as const,
@@ -36,13 +87,31 @@ export function createFunction() {
           "ec2:UpdateSecurityGroupRuleDescriptionsIngress",
         ],
         resources: [
-          $interpolate`arn:aws:ec2:${region.name}:${identity.accountId}:security-group/*`,
+          $interpolate`arn:aws:ec2:*:${identity.accountId}:security-group/*`,
         ],
       },
       {
-        actions: ["ec2:DescribeSecurityGroups"],
+        actions: ["ec2:DescribeSecurityGroups", "ec2:DescribeVpcs", "ec2:DescribeRegions"],
         resources: ["*"],
       },
+      {
+        actions: [
+          "organizations:ListAccounts",
+          "organizations:ListAccountsForParent",
+          "organizations:ListChildren",
+          "organizations:ListTagsForResource",
+        ],
+        resources: ["*"],
+      },
+      {
+        actions: ["sns:Publish"],
+        resources: ["*"],
+      },
+      {
+        actions: ["sts:AssumeRole"],
+        resources: ["arn:aws:iam::*:role/security-group-manager"],
+      },
+      ...optional,
     ],
   });
 
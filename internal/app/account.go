@@ -0,0 +1,139 @@
+package app
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+var roleARN = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(\d{12}):role/.+$`)
+
+// Account is a target AWS account managed through an assumed role.
+// Name labels the account in reports, by default it is the account ID of the RoleARN.
+// An account without a RoleARN is managed with the credentials of the invocation.
+type Account struct {
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	RoleARN    string `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+	ExternalID string `json:"external_id,omitempty" yaml:"external_id,omitempty"`
+}
+
+// EC2Client represents an EC2 client managing security groups, listing regions and VPCs
+type EC2Client interface {
+	sg.Client
+	RegionClient
+	VPCClient
+}
+
+// AccountReport describes the reconciliation of a single account
+type AccountReport struct {
+	Account string          `json:"account"`
+	Skipped []*SkippedGroup `json:"skipped,omitempty"`
+	Regions []*RegionReport `json:"regions,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// RunAccounts reconciles the accounts of a Config (receiver) concurrently, each
+// with clients created for the account and, when Regions are set, for every
+// region. At most Concurrency accounts, or regions of all accounts, are
+// reconciled at the same time. A failed account does not stop the others.
+func (c *Config) RunAccounts(clients func(account *Account, region string) EC2Client) ([]*AccountReport, error) {
+	reports := make([]*AccountReport, len(c.Accounts))
+	c.journal()
+
+	parallel(len(c.Accounts), func(i int) {
+		account := c.Accounts[i]
+
+		// every account keeps its own run state
+		ac := *c
+		ac.skipped = nil
+		ac.account = account.ID()
+		ac.accountName = account.Name
+
+		ctx, span := ac.start("account")
+		ac.ctx = ctx
+
+		reports[i] = &AccountReport{
+			Account: account.label(),
+		}
+
+		var err error
+		if len(c.Regions) > 0 {
+			reports[i].Regions, err = ac.RunRegions(clients(account, ""), func(region string) sg.Client {
+				return clients(account, region)
+			})
+		} else {
+			err = ac.reconcile(func() error {
+				return ac.Run(clients(account, ""))
+			})
+			reports[i].Skipped = ac.skipped
+		}
+
+		if err != nil {
+			logger.WithContext(ctx).WithError(err).WithField("account", account.label()).Error("account run failed")
+			reports[i].Error = err.Error()
+		}
+		end(span, err)
+	})
+
+	failed := make([]string, 0)
+	for _, r := range reports {
+		if r.Error != "" {
+			failed = append(failed, r.Account)
+		}
+	}
+
+	if len(failed) > 0 {
+		return reports, errors.Errorf("error reconciling accounts %v", failed)
+	}
+
+	return reports, nil
+}
+
+// ID returns the account ID of the RoleARN of an Account (receiver),
+// or an empty string for the account of the invocation
+func (a *Account) ID() string {
+	if m := roleARN.FindStringSubmatch(a.RoleARN); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+// label returns the name of an Account (receiver) in reports
+func (a *Account) label() string {
+	if a.Name != "" {
+		return a.Name
+	}
+
+	if id := a.ID(); id != "" {
+		return id
+	}
+
+	return a.RoleARN
+}
+
+// validateAccounts of a Config (receiver)
+func (c *Config) validateAccounts() error {
+	seen := make(map[string]bool)
+
+	for _, account := range c.Accounts {
+		if account.RoleARN != "" && !roleARN.MatchString(account.RoleARN) {
+			return errors.Errorf("invalid role_arn '%s'", account.RoleARN)
+		}
+
+		label := account.label()
+		if label == "" {
+			return errors.New("account has neither a name nor a role_arn")
+		}
+
+		if seen[label] {
+			return errors.Errorf("duplicate account '%s'", label)
+		}
+		seen[label] = true
+	}
+
+	return nil
+}
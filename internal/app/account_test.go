@@ -0,0 +1,231 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+type ec2Client struct {
+	*mocks.SG
+	*mocks.Regions
+	*mocks.VPC
+}
+
+func TestRunAccounts(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := []*app.Account{
+		{RoleARN: "arn:aws:iam::111111111111:role/security-group-manager"},
+		{Name: "sandbox", RoleARN: "arn:aws:iam::222222222222:role/security-group-manager", ExternalID: "secret"},
+	}
+
+	type test struct {
+		Regions         []string
+		Failing         map[string]bool
+		ExpectedError   string
+		ExpectedReports []*app.AccountReport
+	}
+
+	suite := map[string]test{
+		"Operational Region": {
+			Regions:       nil,
+			ExpectedError: "",
+			ExpectedReports: []*app.AccountReport{
+				{Account: "111111111111", Skipped: []*app.SkippedGroup{}},
+				{Account: "sandbox", Skipped: []*app.SkippedGroup{}},
+			},
+		},
+		"Regions": {
+			Regions:       []string{"us-west-2"},
+			ExpectedError: "",
+			ExpectedReports: []*app.AccountReport{
+				{Account: "111111111111", Regions: []*app.RegionReport{{Region: "us-west-2", Skipped: []*app.SkippedGroup{}}}},
+				{Account: "sandbox", Regions: []*app.RegionReport{{Region: "us-west-2", Skipped: []*app.SkippedGroup{}}}},
+			},
+		},
+		"Failed Account": {
+			Regions:       nil,
+			Failing:       map[string]bool{"111111111111": true},
+			ExpectedError: "error reconciling accounts [111111111111]",
+			ExpectedReports: []*app.AccountReport{
+				{Account: "111111111111", Skipped: []*app.SkippedGroup{}, Error: "AccessDenied: not authorized to perform sts:AssumeRole"},
+				{Account: "sandbox", Skipped: []*app.SkippedGroup{}},
+			},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules:    []*app.Rule{},
+			Regions:  tc.Regions,
+			Accounts: accounts,
+		}
+
+		clients := make(map[string]*mocks.SG)
+		for _, account := range []string{"111111111111", "222222222222"} {
+			m := new(mocks.SG)
+			if tc.Failing[account] {
+				m.On("DescribeSecurityGroups", mock.Anything).Return(nil, errors.New("AccessDenied: not authorized to perform sts:AssumeRole")).Once()
+			} else {
+				m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{}, nil).Once()
+			}
+			clients[account] = m
+		}
+
+		reports, err := c.RunAccounts(func(account *app.Account, region string) app.EC2Client {
+			id := strings.Split(account.RoleARN, ":")[4]
+			if len(tc.Regions) > 0 && region == "" {
+				return &ec2Client{Regions: new(mocks.Regions)}
+			}
+			return &ec2Client{SG: clients[id]}
+		})
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedReports, reports)
+
+		for _, m := range clients {
+			m.AssertExpectations(t)
+		}
+	}
+}
+
+func TestRunAccountsRecordsAccountIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+		},
+		Accounts: []*app.Account{
+			{Name: "sandbox", RoleARN: "arn:aws:iam::222222222222:role/security-group-manager"},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{managedGroup("sg-1", []string{"ssh"})},
+	}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	_, err := c.RunAccounts(func(account *app.Account, region string) app.EC2Client {
+		return &ec2Client{SG: m}
+	})
+	assert.NoError(err)
+
+	changes := c.Changes()
+	if assert.Len(changes, 1) {
+		assert.Equal("222222222222", changes[0].Account)
+		assert.Equal("sandbox", changes[0].AccountName)
+	}
+
+	m.AssertExpectations(t)
+}
+
+func TestRunAccountsConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	accounts := make([]*app.Account, 0)
+	for i := 1; i <= 3; i++ {
+		accounts = append(accounts, &app.Account{RoleARN: fmt.Sprintf("arn:aws:iam::%012d:role/security-group-manager", i)})
+	}
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules:       []*app.Rule{},
+		Accounts:    accounts,
+		Regions:     []string{"us-east-1", "us-west-2", "eu-west-1"},
+		Concurrency: 2,
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	// regions of all accounts share the limit
+	reports, err := c.RunAccounts(func(account *app.Account, region string) app.EC2Client {
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", mock.Anything).Run(func(mock.Arguments) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}).Return(&ec2.DescribeSecurityGroupsOutput{}, nil).Maybe()
+		return &ec2Client{SG: m}
+	})
+
+	assert.NoError(err)
+	assert.Len(reports, 3)
+	assert.Equal(2, peak)
+}
+
+func TestLoadInvalidAccounts(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Accounts      string
+		ExpectedError string
+	}
+
+	suite := map[string]test{
+		"Invalid Role": {
+			Accounts:      `[{"role_arn":"arn:aws:iam::1234:user/admin"}]`,
+			ExpectedError: "invalid role_arn 'arn:aws:iam::1234:user/admin'",
+		},
+		"Duplicate Account": {
+			Accounts:      `[{"role_arn":"arn:aws:iam::111111111111:role/a"},{"role_arn":"arn:aws:iam::111111111111:role/b"}]`,
+			ExpectedError: "duplicate account '111111111111'",
+		},
+		"Unnamed Local Account": {
+			Accounts:      `[{}]`,
+			ExpectedError: "account has neither a name nor a role_arn",
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"accounts":` + tc.Accounts + `,"protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+		assert.EqualError(err, tc.ExpectedError)
+	}
+}
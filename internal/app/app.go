@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
 )
@@ -26,91 +28,359 @@ type Group struct {
 	CIDRs []string
 }
 
+// change is a single rule to add to or remove from a security group
+type change struct {
+	log      *logger.Entry
+	rule     *sg.Rule
+	protocol string
+	note     string
+}
+
 // Run is a main thread of this application
 func (c *Config) Run(cli sg.Client) error {
-	for name, protocol := range c.Protocols {
-		groups, err := c.fetch(cli, name)
-		if err != nil {
-			return err
-		}
+	return c.run(cli, c.groups)
+}
 
-		for _, group := range groups {
-			log := logger.WithFields(logger.Fields{
-				"security-group": *group.GroupId,
-				"rule":           name,
-			})
+// RunGroups reconciles only the security groups with the given IDs
+func (c *Config) RunGroups(cli sg.Client, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
 
-			err := c.manage(cli, log, name, protocol, group)
-			if err != nil {
-				return err
+	return c.run(cli, ids)
+}
+
+func (c *Config) run(cli sg.Client, ids []string) error {
+	groups, err := c.fetch(cli, ids)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, group := range groups {
+		log := logger.WithContext(c.ctx).WithField("security-group", *group.GroupId)
+
+		if c.restore != nil {
+			if c.restored(group) == nil {
+				log.Info("skipping security group missing from the snapshot")
+				continue
 			}
+			restored++
+		}
+
+		if c.capturing {
+			c.capture(cli, group)
+			continue
+		}
+
+		if c.inspecting {
+			c.inspect(cli, log, group)
+			continue
+		}
+
+		if !c.ignoreOverrides && c.paused(group) {
+			log.Warnf("management is paused by tag '%s'", c.overrideTag(TagPaused))
+			continue
+		}
+
+		if err := c.manage(cli, log, group); err != nil {
+			c.count(AllProtocols, MetricGroupErrors, 1)
+			return err
 		}
 	}
 
+	if c.restore != nil && len(groups) > 0 && restored == 0 {
+		logger.WithContext(c.ctx).WithFields(logger.Fields{"account": c.account, "region": c.region}).
+			Warn("no security group is in the snapshot, it may have been taken by a run of other accounts or regions")
+	}
+
 	return nil
 }
 
-func (c *Config) fetch(cli sg.Client, name string) ([]*ec2.SecurityGroup, error) {
-	logger.Infof("fetching security groups with tag: '%s=%s'", name, TagProtocolValue)
+// fetch all security groups tagged for any protocol in a single scan,
+// limited to the given IDs unless empty
+func (c *Config) fetch(cli sg.Client, ids []string) (groups []*ec2.SecurityGroup, err error) {
+	ctx, span := c.start("fetch")
+	defer func() { end(span, err) }()
+	cli = traced(ctx, cli)
+	log := logger.WithContext(ctx)
+
+	keys := make([]*string, 0, len(c.Protocols))
+	for _, name := range c.protocolNames() {
+		keys = append(keys, aws.String(c.tagKey(name)))
+	}
+
+	c.skipped = make([]*SkippedGroup, 0)
+
+	vpcs, _ := cli.(VPCClient)
+	included, excluded, err := c.Scope.vpcs(vpcs)
+	if err != nil {
+		return []*ec2.SecurityGroup{}, err
+	}
+
+	if included != nil && len(included) == 0 {
+		log.Warn("no vpc matches the scope, no security groups will be managed")
+	}
 
-	tag := sg.Tag{
-		Key:   aws.String(fmt.Sprintf("tag:%s", name)),
-		Value: aws.String(TagProtocolValue),
+	var filters []*ec2.Filter
+	if len(ids) > 0 {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("group-id"),
+			Values: aws.StringSlice(ids),
+		})
 	}
 
-	groups, err := tag.GetSecurityGroups(cli)
+	log.Infof("fetching security groups with tag keys: %s", aws.StringValueSlice(keys))
+
+	tag := sg.TagKeys{
+		Keys:    keys,
+		Filters: filters,
+	}
+
+	found, err := tag.GetSecurityGroups(cli)
 	if err != nil {
 		return []*ec2.SecurityGroup{}, err
 	}
 
+	groups = make([]*ec2.SecurityGroup, 0, len(found))
 	var list []string
 
-	for _, group := range groups {
+	for _, group := range found {
+		if len(c.protocolsOf(group)) == 0 {
+			continue
+		}
+
+		if reason := c.Scope.skip(group, included, excluded); reason != "" {
+			log.WithField("security-group", *group.GroupId).Warnf("skipping security group out of scope: %s", reason)
+			c.skipped = append(c.skipped, &SkippedGroup{
+				Group:  *group.GroupId,
+				Reason: reason,
+			})
+			continue
+		}
+
+		groups = append(groups, group)
 		list = append(list, *group.GroupId)
 	}
 
-	logger.Infof("found %s matching security groups: %+v", strconv.Itoa(len(list)), list)
+	for _, name := range c.protocolNames() {
+		scanned := 0
+		for _, group := range groups {
+			if value, ok := tagValue(group, c.tagKey(name)); ok && value == c.tagValue() {
+				scanned++
+			}
+		}
+		c.count(name, MetricGroupsScanned, scanned)
+	}
+
+	span.SetAttributes(attribute.Int("security_groups", len(groups)))
+	log.Infof("found %s matching security groups: %+v", strconv.Itoa(len(list)), list)
 
 	return groups, nil
 }
 
-func (c *Config) manage(cli sg.Client, log *logger.Entry, name string, proto *Protocol, target *ec2.SecurityGroup) error {
-	log.Infof("validating rules with 'description=%s'", RuleDescription)
+// manage every protocol of a security group in a single pass, revoking
+// incorrect rules and authorizing missing rules in one call each
+func (c *Config) manage(cli sg.Client, log *logger.Entry, target *ec2.SecurityGroup) (err error) {
+	ctx, span := c.start("manage",
+		AttributeGroup.String(*target.GroupId),
+		AttributeProtocol.StringSlice(c.protocolsOf(target)),
+	)
+	defer func() { end(span, err) }()
+	log = log.WithContext(ctx)
+
+	revoke := make([]*change, 0)
+	authorize := make([]*change, 0)
+
+	for _, name := range c.protocolsOf(target) {
+		proto := c.Protocols[name]
+		log := log.WithField("rule", name)
+
+		if c.restore != nil {
+			if _, ok := c.restored(target).Rules[name]; !ok {
+				log.Info("skipping protocol missing from the snapshot")
+				continue
+			}
+		}
 
-	rules, matchedRules := c.getManagedRules(cli, proto, target)
-	log.Debugf("found %s matching rules: %+v", strconv.Itoa(len(rules)), matchedRules)
+		log.Infof("validating rules with 'description=%s'", c.description())
 
-	groups := c.categorizeRules(proto, rules)
-	log.Debugf("cidr validation results: correct=%s, incorrect=%s, missing=%s", groups.Correct.CIDRs, groups.Incorrect.CIDRs, groups.Missing.CIDRs)
+		rules, matchedRules := c.getManagedRules(cli, proto, target)
+		log.Debugf("found %s matching rules: %+v", strconv.Itoa(len(rules)), matchedRules)
+
+		whitelist := c.whitelist(log, target, name)
+		notes := make(map[string]string, len(whitelist))
+		for _, rule := range whitelist {
+			if rule.CIDR != nil {
+				notes[*rule.CIDR] = rule.Note
+			}
+		}
+
+		groups := c.categorize(proto, whitelist, rules)
+		log.Debugf("cidr validation results: correct=%s, incorrect=%s, missing=%s", groups.Correct.CIDRs, groups.Incorrect.CIDRs, groups.Missing.CIDRs)
+
+		for _, rule := range groups.Incorrect.Rules {
+			cidr := cidrOf(rule.Permissions[0])
+			if c.restore == nil && c.preserved(target, cidr) {
+				log.Warnf("keeping incorrect cidr '%s' because a rule could not be resolved", cidr)
+				continue
+			}
+
+			log.Infof("removing incorrect cidr: '%s'", cidr)
+			revoke = append(revoke, &change{log: log, rule: rule, protocol: name})
+		}
+
+		for _, rule := range groups.Missing.Rules {
+			cidr := cidrOf(rule.Permissions[0])
+			log.Infof("adding missing cidr: '%s'", cidr)
+			authorize = append(authorize, &change{log: log, rule: rule, protocol: name, note: notes[cidr]})
+		}
+	}
+
+	// protocols sharing a transport and ports would repeat permissions, which EC2 rejects
+	revoke, authorize = distinct(revoke), distinct(authorize)
+
+	if c.dryRun {
+		for _, ch := range revoke {
+			ch.log.Warnf("dry run, not removing incorrect cidr: '%s'", cidrOf(ch.rule.Permissions[0]))
+		}
+		for _, ch := range authorize {
+			ch.log.Warnf("dry run, not adding missing cidr: '%s'", cidrOf(ch.rule.Permissions[0]))
+		}
+		return nil
+	}
 
 	securityGroup := &sg.SecurityGroup{
 		ID: target.GroupId,
 	}
 
-	for _, rule := range groups.Incorrect.Rules {
-		log.Infof("removing incorrect cidr: '%s'", *rule.Permissions[0].IpRanges[0].CidrIp)
-		if err := securityGroup.RevokeIngressRule(cli, rule); err != nil {
-			return errors.Wrapf(err, "error removing a cidr '%s' from a security group", *rule.Permissions[0].IpRanges[0].CidrIp)
+	if len(revoke) > 0 {
+		if c.restore != nil {
+			if err := c.revocable(len(revoke)); err != nil {
+				return err
+			}
+		}
+
+		if err := securityGroup.RevokeIngressRule(traced(ctx, cli, protocolsAttribute(revoke)), batch(revoke)); err != nil {
+			return errors.Wrapf(err, "error removing cidrs %s from a security group", cidrsOf(revoke))
+		}
+		c.record(target, ActionRemoved, revoke...)
+	}
+
+	if len(authorize) > 1 {
+		err := securityGroup.AuthorizeIngressRule(traced(ctx, cli, protocolsAttribute(authorize)), batch(authorize))
+		if err == nil {
+			c.record(target, ActionAdded, authorize...)
+			return nil
+		}
+
+		if !strings.Contains(err.Error(), "already exists") && !strings.Contains(err.Error(), "RulesPerSecurityGroupLimitExceeded") {
+			return errors.Wrapf(err, "error adding cidrs %s to a security group", cidrsOf(authorize))
 		}
+
+		log.WithError(err).Warn("batch authorization failed, adding cidrs one by one")
 	}
 
-	for _, rule := range groups.Missing.Rules {
-		log.Infof("adding missing cidr: '%s'", *rule.Permissions[0].IpRanges[0].CidrIp)
-		err := securityGroup.AuthorizeIngressRule(cli, rule)
+	for _, ch := range authorize {
+		cidr := cidrOf(ch.rule.Permissions[0])
+		err := securityGroup.AuthorizeIngressRule(traced(ctx, cli, AttributeProtocol.StringSlice([]string{ch.protocol})), ch.rule)
+		if err == nil {
+			c.record(target, ActionAdded, ch)
+			continue
+		}
+
 		if err != nil && strings.Contains(err.Error(), "already exists") {
-			log.Errorf("duplicate error: cidr '%s' already exist as a not managed rule on requested security group", *rule.Permissions[0].IpRanges[0].CidrIp)
+			ch.log.Errorf("duplicate error: cidr '%s' already exist as a not managed rule on requested security group", cidr)
+			c.count(ch.protocol, MetricDuplicates, 1)
 		} else if err != nil {
 			if strings.Contains(err.Error(), "RulesPerSecurityGroupLimitExceeded") {
-				log.Error("the maximum number of rules per security group has been reached")
+				ch.log.Error("the maximum number of rules per security group has been reached")
+				c.count(ch.protocol, MetricLimitHits, 1)
 				break
 			}
-			return errors.Wrapf(err, "error adding a cidr '%s' to a security group", *rule.Permissions[0].IpRanges[0].CidrIp)
+			return errors.Wrapf(err, "error adding a cidr '%s' to a security group", cidr)
 		}
 	}
 
 	return nil
 }
 
+// protocolNames returns sorted names of all protocols
+func (c *Config) protocolNames() []string {
+	names := make([]string, 0, len(c.Protocols))
+	for name := range c.Protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// protocolsOf returns sorted names of protocols a security group is tagged for
+func (c *Config) protocolsOf(group *ec2.SecurityGroup) []string {
+	names := make([]string, 0)
+	for _, name := range c.protocolNames() {
+		if value, ok := tagValue(group, c.tagKey(name)); ok && value == c.tagValue() {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// batch combines changes into a single rule
+func batch(changes []*change) *sg.Rule {
+	r := &sg.Rule{
+		Permissions: make([]*ec2.IpPermission, 0, len(changes)),
+	}
+
+	for _, ch := range changes {
+		r.Permissions = append(r.Permissions, ch.rule.Permissions...)
+	}
+
+	return r
+}
+
+// distinct returns changes without repeated permissions, keeping the first one
+func distinct(changes []*change) []*change {
+	l := make([]*change, 0, len(changes))
+	seen := make(map[string]bool, len(changes))
+	for _, ch := range changes {
+		p := ch.rule.Permissions[0]
+		key := fmt.Sprintf("%s/%d/%d/%s", aws.StringValue(p.IpProtocol), aws.Int64Value(p.FromPort), aws.Int64Value(p.ToPort), cidrOf(p))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		l = append(l, ch)
+	}
+
+	return l
+}
+
+// protocolsAttribute lists the distinct protocols of changes
+func protocolsAttribute(changes []*change) attribute.KeyValue {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, ch := range changes {
+		if !seen[ch.protocol] {
+			seen[ch.protocol] = true
+			names = append(names, ch.protocol)
+		}
+	}
+
+	return AttributeProtocol.StringSlice(names)
+}
+
+func cidrsOf(changes []*change) []string {
+	cidrs := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		cidrs = append(cidrs, cidrOf(ch.rule.Permissions[0]))
+	}
+
+	return cidrs
+}
+
 func (c *Config) getManagedRules(cli sg.Client, proto *Protocol, sg *ec2.SecurityGroup) ([]*ec2.IpPermission, []string) {
 	rules := make([]*ec2.IpPermission, 0)
 	cidrs := make([]string, 0)
@@ -125,7 +395,7 @@ func (c *Config) getManagedRules(cli sg.Client, proto *Protocol, sg *ec2.Securit
 
 		if equalPorts && equalProtocol {
 			for _, ipRange := range permission.IpRanges {
-				if ipRange.Description != nil && *ipRange.Description == RuleDescription {
+				if ipRange.Description != nil && *ipRange.Description == c.description() {
 					rule := &ec2.IpPermission{
 						FromPort:   permission.FromPort,
 						ToPort:     permission.ToPort,
@@ -142,6 +412,25 @@ func (c *Config) getManagedRules(cli sg.Client, proto *Protocol, sg *ec2.Securit
 					cidrs = append(cidrs, *ipRange.CidrIp)
 				}
 			}
+
+			for _, ipRange := range permission.Ipv6Ranges {
+				if ipRange.Description != nil && *ipRange.Description == c.description() {
+					rule := &ec2.IpPermission{
+						FromPort:   permission.FromPort,
+						ToPort:     permission.ToPort,
+						IpProtocol: permission.IpProtocol,
+						Ipv6Ranges: []*ec2.Ipv6Range{
+							{
+								CidrIpv6:    ipRange.CidrIpv6,
+								Description: ipRange.Description,
+							},
+						},
+					}
+
+					rules = append(rules, rule)
+					cidrs = append(cidrs, *ipRange.CidrIpv6)
+				}
+			}
 		}
 	}
 
@@ -149,6 +438,10 @@ func (c *Config) getManagedRules(cli sg.Client, proto *Protocol, sg *ec2.Securit
 }
 
 func (c *Config) categorizeRules(proto *Protocol, permissions []*ec2.IpPermission) *Catalog {
+	return c.categorize(proto, c.Rules, permissions)
+}
+
+func (c *Config) categorize(proto *Protocol, whitelist []*Rule, permissions []*ec2.IpPermission) *Catalog {
 	groups := Catalog{
 		Correct: &Group{
 			Rules: make([]*sg.Rule, 0),
@@ -165,49 +458,60 @@ func (c *Config) categorizeRules(proto *Protocol, permissions []*ec2.IpPermissio
 	}
 
 	valid := make(map[string]*ec2.IpPermission)
+	rules := c.active(whitelist)
 
-	for _, rule := range c.Rules {
+	for _, rule := range rules {
 		for _, permission := range permissions {
-			if *permission.IpRanges[0].CidrIp == *rule.CIDR {
-				valid[*permission.IpRanges[0].CidrIp] = permission
+			if cidrOf(permission) == *rule.CIDR {
+				valid[cidrOf(permission)] = permission
 
 				r := &sg.Rule{
 					Permissions: []*ec2.IpPermission{permission},
 				}
 
 				groups.Correct.Rules = append(groups.Correct.Rules, r)
-				groups.Correct.CIDRs = append(groups.Correct.CIDRs, *permission.IpRanges[0].CidrIp)
+				groups.Correct.CIDRs = append(groups.Correct.CIDRs, cidrOf(permission))
 			}
 		}
 	}
 
 	for _, permission := range permissions {
-		if valid[*permission.IpRanges[0].CidrIp] == nil {
+		if valid[cidrOf(permission)] == nil {
 			r := &sg.Rule{
 				Permissions: []*ec2.IpPermission{permission},
 			}
 
 			groups.Incorrect.Rules = append(groups.Incorrect.Rules, r)
-			groups.Incorrect.CIDRs = append(groups.Incorrect.CIDRs, *permission.IpRanges[0].CidrIp)
+			groups.Incorrect.CIDRs = append(groups.Incorrect.CIDRs, cidrOf(permission))
 		}
 	}
 
-	for _, rule := range c.Rules {
+	for _, rule := range rules {
 		if valid[*rule.CIDR] == nil {
-			r := &sg.Rule{
-				Permissions: []*ec2.IpPermission{
+			permission := &ec2.IpPermission{
+				FromPort:   proto.FromPort,
+				ToPort:     proto.ToPort,
+				IpProtocol: proto.Transport,
+			}
+
+			if strings.Contains(*rule.CIDR, ":") {
+				permission.Ipv6Ranges = []*ec2.Ipv6Range{
 					{
-						FromPort:   proto.FromPort,
-						ToPort:     proto.ToPort,
-						IpProtocol: proto.Transport,
-						IpRanges: []*ec2.IpRange{
-							{
-								CidrIp:      rule.CIDR,
-								Description: aws.String(RuleDescription),
-							},
-						},
+						CidrIpv6:    rule.CIDR,
+						Description: aws.String(c.description()),
+					},
+				}
+			} else {
+				permission.IpRanges = []*ec2.IpRange{
+					{
+						CidrIp:      rule.CIDR,
+						Description: aws.String(c.description()),
 					},
-				},
+				}
+			}
+
+			r := &sg.Rule{
+				Permissions: []*ec2.IpPermission{permission},
 			}
 
 			groups.Missing.Rules = append(groups.Missing.Rules, r)
@@ -217,3 +521,12 @@ func (c *Config) categorizeRules(proto *Protocol, permissions []*ec2.IpPermissio
 
 	return &groups
 }
+
+// cidrOf returns the IPv4 or IPv6 CIDR of a single-range permission
+func cidrOf(permission *ec2.IpPermission) string {
+	if len(permission.Ipv6Ranges) > 0 {
+		return aws.StringValue(permission.Ipv6Ranges[0].CidrIpv6)
+	}
+
+	return aws.StringValue(permission.IpRanges[0].CidrIp)
+}
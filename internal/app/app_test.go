@@ -1,6 +1,7 @@
 package app_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/ReasonSoftware/security-group-manager/internal/app"
@@ -9,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCategorizeRules(t *testing.T) {
@@ -278,6 +280,84 @@ func TestCategorizeRules(t *testing.T) {
 				},
 			},
 		},
+		"IPv6 Rules": {
+			Receiver: &app.Config{
+				Protocols: map[string]*app.Protocol{
+					"http": {
+						Transport: aws.String("tcp"),
+						FromPort:  aws.Int64(80),
+						ToPort:    aws.Int64(80),
+					},
+				},
+				Rules: []*app.Rule{
+					{
+						CIDR: aws.String("2001:db8::/32"),
+					},
+				},
+			},
+			Parameter1: &app.Protocol{
+				Transport: aws.String("tcp"),
+				FromPort:  aws.Int64(80),
+				ToPort:    aws.Int64(80),
+			},
+			Parameter2: []*ec2.IpPermission{
+				{
+					IpProtocol: aws.String("tcp"),
+					FromPort:   aws.Int64(80),
+					ToPort:     aws.Int64(80),
+					Ipv6Ranges: []*ec2.Ipv6Range{
+						{
+							CidrIpv6: aws.String("2001:db8:1::/48"),
+						},
+					},
+				},
+			},
+			ExpectedOutput: &app.Catalog{
+				Correct: &app.Group{
+					Rules: make([]*sg.Rule, 0),
+					CIDRs: make([]string, 0),
+				},
+				Incorrect: &app.Group{
+					Rules: []*sg.Rule{
+						{
+							Permissions: []*ec2.IpPermission{
+								{
+									IpProtocol: aws.String("tcp"),
+									FromPort:   aws.Int64(80),
+									ToPort:     aws.Int64(80),
+									Ipv6Ranges: []*ec2.Ipv6Range{
+										{
+											CidrIpv6: aws.String("2001:db8:1::/48"),
+										},
+									},
+								},
+							},
+						},
+					},
+					CIDRs: []string{"2001:db8:1::/48"},
+				},
+				Missing: &app.Group{
+					Rules: []*sg.Rule{
+						{
+							Permissions: []*ec2.IpPermission{
+								{
+									IpProtocol: aws.String("tcp"),
+									FromPort:   aws.Int64(80),
+									ToPort:     aws.Int64(80),
+									Ipv6Ranges: []*ec2.Ipv6Range{
+										{
+											CidrIpv6:    aws.String("2001:db8::/32"),
+											Description: aws.String(app.RuleDescription),
+										},
+									},
+								},
+							},
+						},
+					},
+					CIDRs: []string{"2001:db8::/32"},
+				},
+			},
+		},
 		"Empty Permissions": {
 			Receiver: &app.Config{
 				Protocols: map[string]*app.Protocol{
@@ -591,6 +671,64 @@ func TestGetManagedRules(t *testing.T) {
 				"10.0.0.0/16",
 			},
 		},
+		"IPv6 Rule": {
+			Receiver: &app.Config{
+				Protocols: map[string]*app.Protocol{
+					"http": {
+						Transport: aws.String("tcp"),
+						FromPort:  aws.Int64(80),
+						ToPort:    aws.Int64(80),
+					},
+				},
+				Rules: []*app.Rule{
+					{
+						CIDR: aws.String("2001:db8::/32"),
+					},
+				},
+			},
+			Parameter1: &app.Protocol{
+				Transport: aws.String("tcp"),
+				FromPort:  aws.Int64(80),
+				ToPort:    aws.Int64(80),
+			},
+			Parameter2: &ec2.SecurityGroup{
+				IpPermissions: []*ec2.IpPermission{
+					{
+						IpProtocol: aws.String("tcp"),
+						FromPort:   aws.Int64(80),
+						ToPort:     aws.Int64(80),
+						IpRanges: []*ec2.IpRange{
+							{
+								CidrIp:      aws.String("10.0.0.0/16"),
+								Description: aws.String("not-managed-rule-description"),
+							},
+						},
+						Ipv6Ranges: []*ec2.Ipv6Range{
+							{
+								CidrIpv6:    aws.String("2001:db8::/32"),
+								Description: aws.String(app.RuleDescription),
+							},
+						},
+					},
+				},
+			},
+			ExpectedOutput1: []*ec2.IpPermission{
+				{
+					FromPort:   aws.Int64(80),
+					ToPort:     aws.Int64(80),
+					IpProtocol: aws.String("tcp"),
+					Ipv6Ranges: []*ec2.Ipv6Range{
+						{
+							CidrIpv6:    aws.String("2001:db8::/32"),
+							Description: aws.String(app.RuleDescription),
+						},
+					},
+				},
+			},
+			ExpectedOutput2: []string{
+				"2001:db8::/32",
+			},
+		},
 		"Multiple Different Size Security Groups": {
 			Receiver: &app.Config{
 				Protocols: map[string]*app.Protocol{
@@ -1077,3 +1215,177 @@ func TestGetManagedRules(t *testing.T) {
 		assert.Equal(test.ExpectedOutput2, results2)
 	}
 }
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	owned := func(port int64, cidr string) *ec2.IpPermission {
+		return &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(port),
+			ToPort:     aws.Int64(port),
+			IpRanges: []*ec2.IpRange{
+				{
+					CidrIp:      aws.String(cidr),
+					Description: aws.String(app.RuleDescription),
+				},
+			},
+		}
+	}
+
+	type test struct {
+		BatchError    error
+		ExpectedError string
+		ExpectedCalls int
+	}
+
+	suite := map[string]test{
+		"Batched": {
+			BatchError:    nil,
+			ExpectedError: "",
+			ExpectedCalls: 1,
+		},
+		"Duplicate Falls Back To Single Rules": {
+			BatchError:    errors.New("InvalidPermission.Duplicate: the specified rule already exists"),
+			ExpectedError: "",
+			ExpectedCalls: 3,
+		},
+		"Failure": {
+			BatchError:    errors.New("reason"),
+			ExpectedError: "error adding cidrs [10.0.0.0/16 10.0.0.0/16] to a security group: reason",
+			ExpectedCalls: 1,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"http": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(80),
+					ToPort:    aws.Int64(80),
+				},
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16")},
+			},
+		}
+
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", &ec2.DescribeSecurityGroupsInput{
+			MaxResults: aws.Int64(100),
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("tag-key"),
+					Values: []*string{aws.String("http"), aws.String("ssh")},
+				},
+			},
+		}).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				{
+					GroupId: aws.String("sg-1"),
+					Tags: []*ec2.Tag{
+						{Key: aws.String("http"), Value: aws.String(app.TagProtocolValue)},
+						{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+					},
+					IpPermissions: []*ec2.IpPermission{
+						owned(80, "192.168.0.0/16"),
+						owned(22, "172.16.0.0/12"),
+					},
+				},
+				{
+					GroupId: aws.String("sg-2"),
+					Tags: []*ec2.Tag{
+						{Key: aws.String("ssh"), Value: aws.String("unmanaged")},
+					},
+				},
+			},
+		}, nil).Once()
+		m.On("RevokeSecurityGroupIngress", &ec2.RevokeSecurityGroupIngressInput{
+			DryRun:        aws.Bool(false),
+			GroupId:       aws.String("sg-1"),
+			IpPermissions: []*ec2.IpPermission{owned(80, "192.168.0.0/16"), owned(22, "172.16.0.0/12")},
+		}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+		m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+			DryRun:        aws.Bool(false),
+			GroupId:       aws.String("sg-1"),
+			IpPermissions: []*ec2.IpPermission{owned(80, "10.0.0.0/16"), owned(22, "10.0.0.0/16")},
+		}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, tc.BatchError).Once()
+		for _, port := range []int64{80, 22} {
+			m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+				DryRun:        aws.Bool(false),
+				GroupId:       aws.String("sg-1"),
+				IpPermissions: []*ec2.IpPermission{owned(port, "10.0.0.0/16")},
+			}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Maybe()
+		}
+
+		err := c.Run(m)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		m.AssertExpectations(t)
+		m.AssertNumberOfCalls(t, "DescribeSecurityGroups", 1)
+		m.AssertNumberOfCalls(t, "RevokeSecurityGroupIngress", 1)
+		m.AssertNumberOfCalls(t, "AuthorizeSecurityGroupIngress", tc.ExpectedCalls)
+	}
+}
+
+func TestRunSharedPorts(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"sftp": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+			"ssh":  {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+			{CIDR: aws.String("192.168.0.0/16")},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			managedGroup("sg-1", []string{"sftp", "ssh"}, managedPermission(22, "172.16.0.0/12")),
+		},
+	}, nil).Once()
+	// every permission is sent once, although both protocols want it
+	m.On("RevokeSecurityGroupIngress", &ec2.RevokeSecurityGroupIngressInput{
+		DryRun:        aws.Bool(false),
+		GroupId:       aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{managedPermission(22, "172.16.0.0/12")},
+	}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+		DryRun:        aws.Bool(false),
+		GroupId:       aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{managedPermission(22, "10.0.0.0/16"), managedPermission(22, "192.168.0.0/16")},
+	}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	assert.NoError(c.Run(m))
+
+	changes := make([]string, 0)
+	for _, ch := range c.Changes() {
+		changes = append(changes, ch.String())
+	}
+	assert.Equal([]string{
+		"removed 172.16.0.0/12 on sftp of sg-1",
+		"added 10.0.0.0/16 on sftp of sg-1",
+		"added 192.168.0.0/16 on sftp of sg-1",
+	}, changes)
+
+	m.AssertExpectations(t)
+}
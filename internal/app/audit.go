@@ -0,0 +1,235 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// auditBatch is the maximum number of items of a DynamoDB BatchWriteItem call
+const auditBatch = 25
+
+// auditRetries of unprocessed DynamoDB items, backing off exponentially
+const (
+	auditRetries = 3
+	auditBackoff = 50 * time.Millisecond
+)
+
+// AuditRecord describes a single applied change for the audit trail
+type AuditRecord struct {
+	Time          time.Time `json:"timestamp" dynamodbav:"timestamp"`
+	Account       string    `json:"account,omitempty" dynamodbav:"account,omitempty"`
+	AccountName   string    `json:"account_name,omitempty" dynamodbav:"account_name,omitempty"`
+	Region        string    `json:"region,omitempty" dynamodbav:"region,omitempty"`
+	Group         string    `json:"group" dynamodbav:"group"`
+	Protocol      string    `json:"protocol" dynamodbav:"protocol"`
+	CIDR          string    `json:"cidr" dynamodbav:"cidr"`
+	Note          string    `json:"note,omitempty" dynamodbav:"note,omitempty"`
+	Action        string    `json:"action" dynamodbav:"action"`
+	ConfigVersion string    `json:"config_version,omitempty" dynamodbav:"config_version,omitempty"`
+	Invocation    string    `json:"invocation_id,omitempty" dynamodbav:"invocation_id,omitempty"`
+}
+
+// ID uniquely identifies an AuditRecord (receiver) of a security group
+func (r *AuditRecord) ID() string {
+	return strings.Join([]string{r.Time.UTC().Format(time.RFC3339Nano), r.Action, r.Protocol, r.CIDR}, "#")
+}
+
+// AuditSink represents a backend of the audit trail
+type AuditSink interface {
+	// String identifies a particular sink (e.g. "dynamodb:audit")
+	String() string
+	// Write appends records to the audit trail
+	Write(records []*AuditRecord) error
+}
+
+// NewAuditRecords returns audit records of the changes of a Report,
+// labelled with the applied configuration versions and an invocation ID.
+// An empty account or region of a change is replaced by the given defaults.
+func NewAuditRecords(report *Report, invocation, account, region string) []*AuditRecord {
+	versions := make([]string, 0, len(report.Sources))
+	for _, src := range report.Sources {
+		if src.Version != "" {
+			versions = append(versions, src.Version)
+		}
+	}
+
+	records := make([]*AuditRecord, 0, len(report.Changes))
+	for _, m := range report.Changes {
+		records = append(records, &AuditRecord{
+			Time:          m.Time,
+			Account:       defaultString(m.Account, account),
+			AccountName:   m.AccountName,
+			Region:        defaultString(m.Region, region),
+			Group:         m.Group,
+			Protocol:      m.Protocol,
+			CIDR:          m.CIDR,
+			Note:          m.Note,
+			Action:        m.Action,
+			ConfigVersion: strings.Join(versions, ","),
+			Invocation:    invocation,
+		})
+	}
+
+	return records
+}
+
+// Audit writes records to every sink. A failed sink does not stop the others.
+func Audit(sinks []AuditSink, records []*AuditRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	failed := make([]string, 0)
+	for _, sink := range sinks {
+		if err := sink.Write(records); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", sink, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("error writing audit records to %v", failed)
+	}
+
+	return nil
+}
+
+// jsonLines encodes records as JSON lines
+func jsonLines(records []*AuditRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// FileSink appends audit records as JSON lines to a local file
+type FileSink struct {
+	Path string
+}
+
+// String identifies a file
+func (s *FileSink) String() string {
+	return s.Path
+}
+
+// Write appends records to a file, creating it when missing
+func (s *FileSink) Write(records []*AuditRecord) error {
+	data, err := jsonLines(records)
+	if err != nil {
+		return errors.Wrap(err, "error encoding audit records")
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "error opening file")
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "error writing file")
+	}
+
+	return errors.Wrap(f.Close(), "error closing file")
+}
+
+// ObjectSink writes the audit records of every invocation as a JSON lines
+// object named "<prefix><yyyy>/<mm>/<dd>/<time>-<invocation>.jsonl"
+type ObjectSink struct {
+	Client S3Writer
+	Bucket string
+	Prefix string
+}
+
+// String identifies a bucket and a prefix
+func (s *ObjectSink) String() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// Write records as a new object
+func (s *ObjectSink) Write(records []*AuditRecord) error {
+	data, err := jsonLines(records)
+	if err != nil {
+		return errors.Wrap(err, "error encoding audit records")
+	}
+
+	first := records[0]
+	name := first.Time.UTC().Format("20060102T150405.000000000Z")
+	if first.Invocation != "" {
+		name += "-" + first.Invocation
+	}
+
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.Prefix + first.Time.UTC().Format("2006/01/02/") + name + ".jsonl"),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+
+	return errors.Wrap(err, "error writing object")
+}
+
+// TableSink writes audit records as items of a DynamoDB table with
+// a "group" partition key and an "id" sort key (see AuditRecord.ID)
+type TableSink struct {
+	Client DynamoDBClient
+	Table  string
+}
+
+// String identifies a table
+func (s *TableSink) String() string {
+	return "dynamodb:" + s.Table
+}
+
+// Write records in batches, retrying unprocessed items
+func (s *TableSink) Write(records []*AuditRecord) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(records))
+	for _, r := range records {
+		item, err := dynamodbattribute.MarshalMap(r)
+		if err != nil {
+			return errors.Wrap(err, "error encoding audit records")
+		}
+		item["id"] = &dynamodb.AttributeValue{S: aws.String(r.ID())}
+
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		})
+	}
+
+	for start := 0; start < len(requests); start += auditBatch {
+		pending := requests[start:min(start+auditBatch, len(requests))]
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > auditRetries {
+				return errors.Errorf("error writing %d audit records to table", len(pending))
+			}
+			if attempt > 0 {
+				time.Sleep(auditBackoff << (attempt - 1))
+			}
+
+			o, err := s.Client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{s.Table: pending},
+			})
+			if err != nil {
+				return errors.Wrap(err, "error writing table")
+			}
+
+			pending = o.UnprocessedItems[s.Table]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package app_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+var audited = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+func auditRecords(n int) []*app.AuditRecord {
+	records := make([]*app.AuditRecord, 0, n)
+	for i := 0; i < n; i++ {
+		records = append(records, &app.AuditRecord{
+			Time:       audited,
+			Group:      "sg-1",
+			Protocol:   "ssh",
+			CIDR:       fmt.Sprintf("10.0.%d.0/24", i),
+			Action:     app.ActionAdded,
+			Invocation: "request-1",
+		})
+	}
+
+	return records
+}
+
+func readAuditFile(t *testing.T, path string) []*app.AuditRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := make([]*app.AuditRecord, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r app.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, &r)
+	}
+
+	return records
+}
+
+func TestNewAuditRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	report := &app.Report{
+		Sources: []*app.SourceReport{
+			{Source: "secret:whitelist", Version: "a1b2c3d4-5678-90ab-cdef-111111111111"},
+			{Source: "config.yaml"},
+		},
+		Changes: []*app.Modification{
+			{Time: audited, Account: "111111111111", Region: "us-west-2", Group: "sg-1", Protocol: "ssh", CIDR: "10.0.0.0/16", Note: "New Jersey Office", Action: app.ActionAdded},
+			{Time: audited, Group: "sg-2", Protocol: "ssh", CIDR: "10.1.0.0/16", Action: app.ActionRemoved},
+		},
+	}
+
+	assert.Equal([]*app.AuditRecord{
+		{
+			Time:          audited,
+			Account:       "111111111111",
+			Region:        "us-west-2",
+			Group:         "sg-1",
+			Protocol:      "ssh",
+			CIDR:          "10.0.0.0/16",
+			Note:          "New Jersey Office",
+			Action:        app.ActionAdded,
+			ConfigVersion: "a1b2c3d4-5678-90ab-cdef-111111111111",
+			Invocation:    "request-1",
+		},
+		{
+			Time:          audited,
+			Account:       "222222222222",
+			Region:        "us-east-1",
+			Group:         "sg-2",
+			Protocol:      "ssh",
+			CIDR:          "10.1.0.0/16",
+			Action:        app.ActionRemoved,
+			ConfigVersion: "a1b2c3d4-5678-90ab-cdef-111111111111",
+			Invocation:    "request-1",
+		},
+	}, app.NewAuditRecords(report, "request-1", "222222222222", "us-east-1"))
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := &app.FileSink{Path: path}
+	records := auditRecords(3)
+
+	assert.NoError(sink.Write(records[:2]))
+	assert.NoError(sink.Write(records[2:]))
+
+	assert.Equal(records, readAuditFile(t, path))
+}
+
+func TestObjectSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var body []byte
+	m := new(mocks.S3)
+	m.On("PutObject", mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		body, _ = io.ReadAll(input.Body)
+		return *input.Bucket == "audit" && *input.Key == "sgm/2026/10/19/20261019T080000.000000000Z-request-1.jsonl"
+	})).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	sink := &app.ObjectSink{Client: m, Bucket: "audit", Prefix: "sgm/"}
+	assert.NoError(sink.Write(auditRecords(2)))
+	assert.Equal(
+		`{"timestamp":"2026-10-19T08:00:00Z","group":"sg-1","protocol":"ssh","cidr":"10.0.0.0/24","action":"added","invocation_id":"request-1"}`+"\n"+
+			`{"timestamp":"2026-10-19T08:00:00Z","group":"sg-1","protocol":"ssh","cidr":"10.0.1.0/24","action":"added","invocation_id":"request-1"}`+"\n",
+		string(body),
+	)
+
+	m.AssertExpectations(t)
+}
+
+func TestTableSink(t *testing.T) {
+	type test struct {
+		Records       int
+		Responses     []*dynamodb.BatchWriteItemOutput
+		ResponseError error
+		ExpectedCalls []int
+		ExpectedError string
+	}
+
+	unprocessed := func(n int) *dynamodb.BatchWriteItemOutput {
+		requests := make([]*dynamodb.WriteRequest, n)
+		for i := range requests {
+			requests[i] = &dynamodb.WriteRequest{}
+		}
+		return &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{"audit": requests}}
+	}
+
+	suite := map[string]test{
+		"Batches": {
+			Records:       30,
+			Responses:     []*dynamodb.BatchWriteItemOutput{{}, {}},
+			ExpectedCalls: []int{25, 5},
+			ExpectedError: "",
+		},
+		"Retry Unprocessed": {
+			Records:       3,
+			Responses:     []*dynamodb.BatchWriteItemOutput{unprocessed(1), {}},
+			ExpectedCalls: []int{3, 1},
+			ExpectedError: "",
+		},
+		"Unprocessed": {
+			Records:       1,
+			Responses:     []*dynamodb.BatchWriteItemOutput{unprocessed(1), unprocessed(1), unprocessed(1), unprocessed(1)},
+			ExpectedCalls: []int{1, 1, 1, 1},
+			ExpectedError: "error writing 1 audit records to table",
+		},
+		"Failure": {
+			Records:       1,
+			Responses:     []*dynamodb.BatchWriteItemOutput{nil},
+			ResponseError: errors.New("reason"),
+			ExpectedCalls: []int{1},
+			ExpectedError: "error writing table: reason",
+		},
+	}
+
+	var counter int
+	for name, test := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+		assert := assert.New(t)
+
+		var calls []int
+		m := new(mocks.DynamoDB)
+		for _, response := range test.Responses {
+			m.On("BatchWriteItem", mock.MatchedBy(func(input *dynamodb.BatchWriteItemInput) bool {
+				return len(input.RequestItems["audit"]) > 0
+			})).Run(func(args mock.Arguments) {
+				input := args.Get(0).(*dynamodb.BatchWriteItemInput)
+				calls = append(calls, len(input.RequestItems["audit"]))
+			}).Return(response, test.ResponseError).Once()
+		}
+
+		sink := &app.TableSink{Client: m, Table: "audit"}
+		err := sink.Write(auditRecords(test.Records))
+
+		if test.ExpectedError != "" {
+			assert.EqualError(err, test.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+		assert.Equal(test.ExpectedCalls, calls)
+
+		m.AssertExpectations(t)
+	}
+}
+
+func TestTableSinkItem(t *testing.T) {
+	assert := assert.New(t)
+
+	m := new(mocks.DynamoDB)
+	m.On("BatchWriteItem", mock.MatchedBy(func(input *dynamodb.BatchWriteItemInput) bool {
+		item := input.RequestItems["audit"][0].PutRequest.Item
+		return *item["group"].S == "sg-1" &&
+			*item["id"].S == "2026-10-19T08:00:00Z#added#ssh#10.0.0.0/24" &&
+			*item["timestamp"].S == "2026-10-19T08:00:00Z" &&
+			*item["invocation_id"].S == "request-1" &&
+			item["account"] == nil
+	})).Return(&dynamodb.BatchWriteItemOutput{}, nil).Once()
+
+	sink := &app.TableSink{Client: m, Table: "audit"}
+	assert.NoError(sink.Write(auditRecords(1)))
+
+	m.AssertExpectations(t)
+}
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	m := new(mocks.S3)
+	m.On("PutObject", mock.Anything).Return(nil, errors.New("reason")).Once()
+
+	sinks := []app.AuditSink{
+		&app.ObjectSink{Client: m, Bucket: "audit"},
+		&app.FileSink{Path: path},
+	}
+
+	assert.NoError(app.Audit(sinks, []*app.AuditRecord{}))
+	_, err := os.Stat(path)
+	assert.True(os.IsNotExist(err))
+
+	records := auditRecords(1)
+	assert.EqualError(app.Audit(sinks, records), "error writing audit records to [s3://audit/ (error writing object: reason)]")
+	assert.Equal(records, readAuditFile(t, path))
+
+	m.AssertExpectations(t)
+}
+
+func TestAuditedRun(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+		},
+	}
+	app.SetClock(c, func() time.Time { return audited })
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	assert.NoError(c.Run(m))
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	report := &app.Report{Changes: c.Changes()}
+	assert.NoError(app.Audit([]app.AuditSink{&app.FileSink{Path: path}}, app.NewAuditRecords(report, "request-1", "111111111111", "us-east-1")))
+
+	assert.Equal([]*app.AuditRecord{
+		{Time: audited, Account: "111111111111", Region: "us-east-1", Group: "sg-1", Protocol: "ssh", CIDR: "10.0.0.0/16", Action: app.ActionAdded, Invocation: "request-1"},
+	}, readAuditFile(t, path))
+
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,301 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+// Formats of a ComplianceReport
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// StatusCompliant and StatusDrifted are the statuses of a GroupCompliance
+const (
+	StatusCompliant = "compliant"
+	StatusDrifted   = "drifted"
+)
+
+// ComplianceReport describes whether managed security groups match the whitelist
+type ComplianceReport struct {
+	Time   time.Time          `json:"time"`
+	Groups []*GroupCompliance `json:"groups"`
+}
+
+// GroupCompliance compares the rules of a protocol of a security group with
+// the whitelist. Unmanaged are CIDRs of rules on the ports of the protocol
+// without the managed description, and Duplicates are missing CIDRs which
+// cannot be authorized because of such unmanaged rules.
+type GroupCompliance struct {
+	Account    string   `json:"account,omitempty"`
+	Region     string   `json:"region,omitempty"`
+	Group      string   `json:"group"`
+	Protocol   string   `json:"protocol"`
+	Status     string   `json:"status"`
+	Paused     bool     `json:"paused,omitempty"`
+	Correct    []string `json:"correct"`
+	Incorrect  []string `json:"incorrect"`
+	Missing    []string `json:"missing"`
+	Unmanaged  []string `json:"unmanaged"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// FormatOf returns the format of a compliance report written to a location,
+// inferred from its extension unless a format is given
+func FormatOf(location, format string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(path.Ext(location)) {
+		case ".csv":
+			return FormatCSV, nil
+		case ".md":
+			return FormatMarkdown, nil
+		case ".json":
+			return FormatJSON, nil
+		}
+		if location == "-" {
+			return FormatMarkdown, nil
+		}
+		return FormatJSON, nil
+	}
+
+	switch format {
+	case FormatJSON, FormatCSV, FormatMarkdown:
+		return format, nil
+	}
+
+	return "", errors.Errorf("unknown compliance format '%s'", format)
+}
+
+// Compliance returns the report of security groups inspected by runs of a Config (receiver)
+func (c *Config) Compliance() *ComplianceReport {
+	j := c.journal()
+
+	j.mu.Lock()
+	groups := append([]*GroupCompliance{}, j.compliance...)
+	j.mu.Unlock()
+
+	sort.Slice(groups, func(a, b int) bool {
+		ka := groups[a].Account + "/" + groups[a].Region + "/" + groups[a].Group + "/" + groups[a].Protocol
+		kb := groups[b].Account + "/" + groups[b].Region + "/" + groups[b].Group + "/" + groups[b].Protocol
+		return ka < kb
+	})
+
+	return &ComplianceReport{
+		Time:   c.now(),
+		Groups: groups,
+	}
+}
+
+// inspect every protocol of a security group without modifying it
+func (c *Config) inspect(cli sg.Client, log *logger.Entry, group *ec2.SecurityGroup) {
+	paused := !c.ignoreOverrides && c.paused(group)
+	results := make([]*GroupCompliance, 0)
+
+	for _, name := range c.protocolsOf(group) {
+		if c.restore != nil {
+			if _, ok := c.restored(group).Rules[name]; !ok {
+				continue
+			}
+		}
+
+		proto := c.Protocols[name]
+		rules, _ := c.getManagedRules(cli, proto, group)
+		catalog := c.categorize(proto, c.whitelist(log, group, name), rules)
+
+		unmanaged := c.unmanagedCIDRs(proto, group)
+		duplicates := make([]string, 0)
+		for _, cidr := range catalog.Missing.CIDRs {
+			for _, u := range unmanaged {
+				if u == cidr {
+					duplicates = append(duplicates, cidr)
+					break
+				}
+			}
+		}
+
+		result := &GroupCompliance{
+			Account:    c.account,
+			Region:     c.region,
+			Group:      aws.StringValue(group.GroupId),
+			Protocol:   name,
+			Status:     StatusCompliant,
+			Paused:     paused,
+			Correct:    sorted(catalog.Correct.CIDRs),
+			Incorrect:  sorted(catalog.Incorrect.CIDRs),
+			Missing:    sorted(catalog.Missing.CIDRs),
+			Unmanaged:  sorted(unmanaged),
+			Duplicates: sorted(duplicates),
+		}
+		if len(result.Incorrect) > 0 || len(result.Missing) > 0 || len(result.Unmanaged) > 0 {
+			result.Status = StatusDrifted
+			log.WithField("rule", name).Warnf("drift detected: incorrect=%s, missing=%s, unmanaged=%s", result.Incorrect, result.Missing, result.Unmanaged)
+		}
+
+		results = append(results, result)
+	}
+
+	j := c.journal()
+	j.mu.Lock()
+	j.compliance = append(j.compliance, results...)
+	j.mu.Unlock()
+}
+
+// unmanagedCIDRs returns CIDRs of rules on the ports of a protocol
+// which are not managed by this deployment
+func (c *Config) unmanagedCIDRs(proto *Protocol, group *ec2.SecurityGroup) []string {
+	cidrs := make([]string, 0)
+
+	for _, permission := range group.IpPermissions {
+		if permission.FromPort == nil || permission.ToPort == nil || permission.IpProtocol == nil {
+			continue
+		}
+
+		if *permission.FromPort != *proto.FromPort || *permission.ToPort != *proto.ToPort || *permission.IpProtocol != *proto.Transport {
+			continue
+		}
+
+		for _, ipRange := range permission.IpRanges {
+			if aws.StringValue(ipRange.Description) != c.description() {
+				cidrs = append(cidrs, aws.StringValue(ipRange.CidrIp))
+			}
+		}
+
+		for _, ipRange := range permission.Ipv6Ranges {
+			if aws.StringValue(ipRange.Description) != c.description() {
+				cidrs = append(cidrs, aws.StringValue(ipRange.CidrIpv6))
+			}
+		}
+	}
+
+	return cidrs
+}
+
+// sorted returns a sorted copy of a list, never nil
+func sorted(list []string) []string {
+	out := append([]string{}, list...)
+	sort.Strings(out)
+
+	return out
+}
+
+// Drifted returns the number of drifted results of a ComplianceReport (receiver)
+func (r *ComplianceReport) Drifted() int {
+	n := 0
+	for _, g := range r.Groups {
+		if g.Status == StatusDrifted {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Write a ComplianceReport (receiver) in a format
+func (r *ComplianceReport) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatMarkdown:
+		return r.writeMarkdown(w)
+	}
+
+	return errors.Errorf("unknown compliance format '%s'", format)
+}
+
+func (r *ComplianceReport) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+
+	header := []string{"account", "region", "group", "protocol", "status", "paused", "correct", "incorrect", "missing", "unmanaged", "duplicates"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, g := range r.Groups {
+		row := []string{
+			g.Account,
+			g.Region,
+			g.Group,
+			g.Protocol,
+			g.Status,
+			strconv.FormatBool(g.Paused),
+			strings.Join(g.Correct, " "),
+			strings.Join(g.Incorrect, " "),
+			strings.Join(g.Missing, " "),
+			strings.Join(g.Unmanaged, " "),
+			strings.Join(g.Duplicates, " "),
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+func (r *ComplianceReport) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	groups := make(map[string]bool)
+	for _, g := range r.Groups {
+		groups[g.Account+"/"+g.Region+"/"+g.Group] = true
+	}
+
+	fmt.Fprintf(&b, "# Compliance Report\n\n")
+	fmt.Fprintf(&b, "Generated at %s for %d security groups: %d of %d protocols compliant, %d drifted.\n",
+		r.Time.UTC().Format(time.RFC3339), len(groups), len(r.Groups)-r.Drifted(), len(r.Groups), r.Drifted())
+
+	if len(r.Groups) > 0 {
+		fmt.Fprintf(&b, "\n| Security Group | Protocol | Status | Incorrect | Missing | Unmanaged | Duplicates |\n")
+		fmt.Fprintf(&b, "|---|---|---|---|---|---|---|\n")
+
+		for _, g := range r.Groups {
+			name := g.Group
+			if g.Account != "" || g.Region != "" {
+				name += " (" + strings.Trim(g.Account+"/"+g.Region, "/") + ")"
+			}
+
+			status := g.Status
+			if g.Paused {
+				status += ", paused"
+			}
+
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n",
+				name, g.Protocol, status, cells(g.Incorrect), cells(g.Missing), cells(g.Unmanaged), cells(g.Duplicates))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// cells formats CIDRs of a Markdown table cell
+func cells(cidrs []string) string {
+	if len(cidrs) == 0 {
+		return "-"
+	}
+
+	return strings.Join(cidrs, ", ")
+}
@@ -0,0 +1,192 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func TestCompliance(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+			{CIDR: aws.String("172.16.0.0/12")},
+		},
+	}
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	app.SetClock(c, func() time.Time { return now })
+
+	drifted := managedGroup("sg-2", []string{"ssh"}, managedPermission(22, "192.168.0.0/16"))
+	drifted.IpPermissions[0].IpRanges = append(drifted.IpPermissions[0].IpRanges, &ec2.IpRange{CidrIp: aws.String("172.16.0.0/12")})
+	drifted.Tags = append(drifted.Tags, &ec2.Tag{Key: aws.String(app.TagPaused), Value: aws.String("true")})
+
+	// no security group is modified
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			drifted,
+			managedGroup("sg-1", []string{"ssh"}, managedPermission(22, "10.0.0.0/16", "172.16.0.0/12")),
+		},
+	}, nil).Once()
+
+	assert.NoError(c.Apply(&app.Invocation{Compliance: "report.md"}))
+	assert.NoError(c.Run(m))
+	assert.Empty(c.Changes())
+
+	report := c.Compliance()
+	assert.Equal(&app.ComplianceReport{
+		Time: now,
+		Groups: []*app.GroupCompliance{
+			{
+				Group:      "sg-1",
+				Protocol:   "ssh",
+				Status:     app.StatusCompliant,
+				Correct:    []string{"10.0.0.0/16", "172.16.0.0/12"},
+				Incorrect:  []string{},
+				Missing:    []string{},
+				Unmanaged:  []string{},
+				Duplicates: []string{},
+			},
+			{
+				Group:      "sg-2",
+				Protocol:   "ssh",
+				Status:     app.StatusDrifted,
+				Paused:     true,
+				Correct:    []string{},
+				Incorrect:  []string{"192.168.0.0/16"},
+				Missing:    []string{"10.0.0.0/16", "172.16.0.0/12"},
+				Unmanaged:  []string{"172.16.0.0/12"},
+				Duplicates: []string{"172.16.0.0/12"},
+			},
+		},
+	}, report)
+	assert.Equal(1, report.Drifted())
+
+	var out bytes.Buffer
+	assert.NoError(report.Write(&out, app.FormatCSV))
+	assert.Equal(`account,region,group,protocol,status,paused,correct,incorrect,missing,unmanaged,duplicates
+,,sg-1,ssh,compliant,false,10.0.0.0/16 172.16.0.0/12,,,,
+,,sg-2,ssh,drifted,true,,192.168.0.0/16,10.0.0.0/16 172.16.0.0/12,172.16.0.0/12,172.16.0.0/12
+`, out.String())
+
+	out.Reset()
+	assert.NoError(report.Write(&out, app.FormatMarkdown))
+	assert.Equal(`# Compliance Report
+
+Generated at 2026-10-19T08:00:00Z for 2 security groups: 1 of 2 protocols compliant, 1 drifted.
+
+| Security Group | Protocol | Status | Incorrect | Missing | Unmanaged | Duplicates |
+|---|---|---|---|---|---|---|
+| sg-1 | ssh | compliant | - | - | - | - |
+| sg-2 | ssh | drifted, paused | 192.168.0.0/16 | 10.0.0.0/16, 172.16.0.0/12 | 172.16.0.0/12 | 172.16.0.0/12 |
+`, out.String())
+
+	out.Reset()
+	assert.NoError(report.Write(&out, app.FormatJSON))
+	var decoded app.ComplianceReport
+	assert.NoError(json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(report, &decoded)
+
+	assert.EqualError(report.Write(&out, "pdf"), "unknown compliance format 'pdf'")
+
+	m.AssertExpectations(t)
+}
+
+func TestComplianceOfRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	snapshot := &app.Snapshot{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Groups: []*app.GroupSnapshot{
+			{Group: "sg-1", Rules: map[string][]string{"ssh": {"10.0.0.0/16"}}},
+		},
+	}
+
+	c := new(app.Config)
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	app.SetClock(c, func() time.Time { return now })
+	c.Restore(snapshot)
+
+	// sg-2 is missing from the snapshot
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			managedGroup("sg-1", []string{"ssh"}, managedPermission(22, "10.0.0.0/16", "172.16.0.0/12")),
+			managedGroup("sg-2", []string{"ssh"}, managedPermission(22, "10.0.0.0/16")),
+		},
+	}, nil).Once()
+
+	assert.NoError(c.Apply(&app.Invocation{Restore: "snapshot.json", Compliance: "report.md"}))
+	assert.NoError(c.Run(m))
+	assert.Empty(c.Changes())
+
+	assert.Equal(&app.ComplianceReport{
+		Time: now,
+		Groups: []*app.GroupCompliance{
+			{
+				Group:      "sg-1",
+				Protocol:   "ssh",
+				Status:     app.StatusDrifted,
+				Correct:    []string{"10.0.0.0/16"},
+				Incorrect:  []string{"172.16.0.0/12"},
+				Missing:    []string{},
+				Unmanaged:  []string{},
+				Duplicates: []string{},
+			},
+		},
+	}, c.Compliance())
+
+	m.AssertExpectations(t)
+}
+
+func TestFormatOf(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Location       string
+		Format         string
+		ExpectedFormat string
+		ExpectedError  string
+	}
+
+	suite := map[string]test{
+		"CSV Extension":      {Location: "s3://reports/drift.csv", ExpectedFormat: app.FormatCSV},
+		"Markdown Extension": {Location: "drift.MD", ExpectedFormat: app.FormatMarkdown},
+		"JSON Extension":     {Location: "drift.json", ExpectedFormat: app.FormatJSON},
+		"No Extension":       {Location: "s3://reports/drift", ExpectedFormat: app.FormatJSON},
+		"Stdout":             {Location: "-", ExpectedFormat: app.FormatMarkdown},
+		"Explicit":           {Location: "drift.json", Format: app.FormatCSV, ExpectedFormat: app.FormatCSV},
+		"Unknown":            {Location: "drift.pdf", Format: "pdf", ExpectedError: "unknown compliance format 'pdf'"},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		format, err := app.FormatOf(tc.Location, tc.Format)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedFormat, format)
+		}
+	}
+}
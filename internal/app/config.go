@@ -1,37 +1,284 @@
 package app
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // GetConfig returns parsed Configuration from AWS Secrets Manager.
 // The secret is fetched on every Lambda invocation so IP changes
 // propagate within one cron cycle without requiring a redeploy.
 func GetConfig(cli Client, secret string) (*Config, error) {
-	o, err := cli.GetSecretValue(&secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secret),
-		VersionStage: aws.String("AWSCURRENT"),
+	return LoadConfig(&SecretSource{
+		Client: cli,
+		Secret: secret,
 	})
-	if err != nil {
-		return new(Config), errors.Wrap(err, "error fetching secret")
+}
+
+// LoadConfig returns parsed Configuration merged from an ordered list of
+// Sources. Every following source is an overlay on top of the previous ones:
+//   - a protocol replaces a protocol of the same name, and a null protocol removes it
+//   - a rule set replaces a rule set of the same name, and a null rule set removes it
+//   - a rule replaces a rule with the same CIDR, and a rule with "remove": true drops it
+//
+// When the result fails to parse or validate, the source of the failed
+// document is re-read at its last-known-good version, while every other
+// source keeps the document it returned. A failure of the merged result is
+// attributed to the last source with a configured Fallback.
+func LoadConfig(srcs ...Source) (*Config, error) {
+	if len(srcs) == 0 {
+		return new(Config), errors.New("no configuration source")
+	}
+
+	docs := make([][]byte, len(srcs))
+	for i, src := range srcs {
+		data, err := src.Fetch()
+		if err != nil {
+			return new(Config), err
+		}
+		docs[i] = data
+	}
+
+	c, failed, err := load(srcs, docs)
+	if err == nil {
+		return c, nil
 	}
 
-	if o.SecretString == nil {
-		return new(Config), errors.New("secret has no SecretString payload (binary secrets are not supported)")
+	if failed < 0 {
+		failed = lastFallback(srcs)
+	}
+	f, ok := fallbackOf(srcs, failed)
+	if !ok {
+		return c, err
+	}
+
+	logger.WithError(err).WithField("source", srcs[failed].String()).Warn("CONFIGURATION IS INVALID, FALLING BACK TO THE LAST-KNOWN-GOOD VERSION")
+
+	data, ferr := f.FetchFallback()
+	if ferr == nil {
+		docs[failed] = data
+		c, _, ferr = load(srcs, docs)
+	}
+	if ferr != nil {
+		return new(Config), errors.Wrapf(ferr, "error loading fallback configuration of %s", srcs[failed])
 	}
 
+	return c, nil
+}
+
+// load configuration from the documents of all sources, returning the index
+// of the source whose document failed to parse, or -1 when the error is
+// caused by the merged configuration
+func load(srcs []Source, docs [][]byte) (*Config, int, error) {
 	c := new(Config)
-	if err := json.Unmarshal([]byte(*o.SecretString), c); err != nil {
-		return new(Config), errors.Wrap(err, "error parsing secret")
+	provenance := make(map[string]string)
+
+	for i, src := range srcs {
+		data := docs[i]
+
+		layer := new(Config)
+		if err := unmarshal(data, layer); err != nil {
+			return new(Config), i, errors.Wrapf(err, "error parsing %s", src.Kind())
+		}
+
+		c.merge(layer, src.String(), provenance)
 	}
 
 	if len(c.Protocols) == 0 || len(c.Rules) == 0 {
-		return new(Config), errors.New("malformed secret")
+		kind := "configuration"
+		if len(srcs) == 1 {
+			kind = srcs[0].Kind()
+		}
+		return new(Config), -1, errors.Errorf("malformed %s", kind)
 	}
 
-	return c, nil
+	if _, err := c.expiryWarning(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.validateTags(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.Scope.validate(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.validateRegions(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.validateAccounts(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.Discovery.validate(); err != nil {
+		return new(Config), -1, err
+	}
+
+	if err := c.Notifications.validate(); err != nil {
+		return new(Config), -1, err
+	}
+
+	for _, rule := range c.allRules() {
+		if rule.Schedule == nil {
+			continue
+		}
+
+		if _, err := rule.Schedule.parse(); err != nil {
+			return new(Config), -1, errors.Wrapf(err, "invalid schedule of rule '%s'", rule.key())
+		}
+	}
+
+	if len(srcs) > 1 {
+		for _, rule := range c.Rules {
+			logger.WithFields(logger.Fields{
+				"rule":   rule.key(),
+				"source": provenance[rule.key()],
+			}).Info("loaded rule")
+		}
+	}
+
+	return c, -1, nil
+}
+
+// lastFallback returns the index of the last source with a configured Fallback, or -1
+func lastFallback(srcs []Source) int {
+	for i := len(srcs) - 1; i >= 0; i-- {
+		if _, ok := fallbackOf(srcs, i); ok {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// fallbackOf returns the Fallback of a source when it has one configured
+func fallbackOf(srcs []Source, i int) (Fallback, bool) {
+	if i < 0 {
+		return nil, false
+	}
+
+	f, ok := srcs[i].(Fallback)
+
+	return f, ok && f.HasFallback()
+}
+
+// merge an overlay into a configuration (receiver), recording the
+// source of every added or replaced rule
+func (c *Config) merge(layer *Config, source string, provenance map[string]string) {
+	for _, field := range []struct{ dst, src *string }{
+		{&c.ExpiryWarning, &layer.ExpiryWarning},
+		{&c.TagKey, &layer.TagKey},
+		{&c.TagValue, &layer.TagValue},
+		{&c.TagPrefix, &layer.TagPrefix},
+		{&c.RuleDescription, &layer.RuleDescription},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+
+	if layer.Scope != nil {
+		c.Scope = layer.Scope
+	}
+
+	if layer.Regions != nil {
+		c.Regions = layer.Regions
+	}
+
+	if layer.Accounts != nil {
+		c.Accounts = layer.Accounts
+	}
+
+	if layer.Concurrency != 0 {
+		c.Concurrency = layer.Concurrency
+	}
+
+	if layer.Discovery != nil {
+		c.Discovery = layer.Discovery
+	}
+
+	if layer.Notifications != nil {
+		c.Notifications = layer.Notifications
+	}
+
+	for name, set := range layer.RuleSets {
+		if c.RuleSets == nil {
+			c.RuleSets = make(map[string][]*Rule)
+		}
+
+		if set == nil {
+			delete(c.RuleSets, name)
+			continue
+		}
+
+		c.RuleSets[name] = set
+	}
+
+	for name, proto := range layer.Protocols {
+		if c.Protocols == nil {
+			c.Protocols = make(map[string]*Protocol)
+		}
+
+		if proto == nil {
+			delete(c.Protocols, name)
+			continue
+		}
+
+		c.Protocols[name] = proto
+	}
+
+	for _, rule := range layer.Rules {
+		key := rule.key()
+		index := -1
+		for i, existing := range c.Rules {
+			if existing.key() == key {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case rule.Remove && index >= 0:
+			c.Rules = append(c.Rules[:index], c.Rules[index+1:]...)
+			delete(provenance, key)
+		case rule.Remove:
+		case index >= 0:
+			c.Rules[index] = rule
+			provenance[key] = source
+		default:
+			c.Rules = append(c.Rules, rule)
+			provenance[key] = source
+		}
+	}
+}
+
+// key identifies a rule across overlays
+func (r *Rule) key() string {
+	if r.Feed != nil {
+		return fmt.Sprintf("feed:%s?%s", r.Feed.URL, r.Feed.Filter)
+	}
+
+	if r.Host != "" {
+		return "host:" + r.Host
+	}
+
+	return aws.StringValue(r.CIDR)
+}
+
+// unmarshal a JSON or YAML document. A document starting with '{' is
+// treated as JSON so existing secrets keep their exact error messages.
+func unmarshal(data []byte, c *Config) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return json.Unmarshal(data, c)
+	}
+
+	return yaml.Unmarshal(data, c)
 }
@@ -1,6 +1,9 @@
 package app_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -73,10 +76,54 @@ func TestGetConfig(t *testing.T) {
 					},
 				},
 				Rules: []*app.Rule{
-					{CIDR: aws.String("10.0.0.0/16")},
-					{CIDR: aws.String("192.168.0.0/16")},
+					{CIDR: aws.String("10.0.0.0/16"), Note: "New Jersey Office"},
+					{CIDR: aws.String("192.168.0.0/16"), Note: "London Office"},
+				},
+			},
+		},
+		"YAML": {
+			MockOutput: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`# managed by the security team
+protocols:
+  http:
+    transport: tcp
+    from_port: 80
+    to_port: 80
+rules:
+  - cidr: 10.0.0.0/16
+    note: New Jersey Office # primary
+`),
+			},
+			MockError:     nil,
+			ExpectedError: "",
+			ExpectedOutput: &app.Config{
+				Protocols: map[string]*app.Protocol{
+					"http": {
+						Transport: aws.String("tcp"),
+						FromPort:  aws.Int64(80),
+						ToPort:    aws.Int64(80),
+					},
 				},
+				Rules: []*app.Rule{
+					{CIDR: aws.String("10.0.0.0/16"), Note: "New Jersey Office"},
+				},
+			},
+		},
+		"Invalid YAML": {
+			MockOutput: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String("protocols: [http"),
+			},
+			MockError:      nil,
+			ExpectedError:  "error parsing secret: yaml: line 1: did not find expected ',' or ']'",
+			ExpectedOutput: &app.Config{},
+		},
+		"Empty Rules Section (YAML)": {
+			MockOutput: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String("protocols:\n  http:\n    transport: tcp\n    from_port: 80\n    to_port: 80\n"),
 			},
+			MockError:      nil,
+			ExpectedError:  "malformed secret",
+			ExpectedOutput: &app.Config{},
 		},
 		"Secrets Manager API Failure": {
 			MockOutput:     &secretsmanager.GetSecretValueOutput{},
@@ -135,3 +182,340 @@ func TestGetConfig(t *testing.T) {
 		assert.Equal(tc.ExpectedOutput, result)
 	}
 }
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.0.0.0/16"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"http": {
+				Transport: aws.String("tcp"),
+				FromPort:  aws.Int64(80),
+				ToPort:    aws.Int64(80),
+			},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+		},
+	}
+
+	type test struct {
+		Sources        []app.Source
+		ExpectedError  string
+		ExpectedOutput *app.Config
+	}
+
+	suite := map[string]test{
+		"File": {
+			Sources:        []app.Source{&app.FileSource{Path: valid}},
+			ExpectedError:  "",
+			ExpectedOutput: expected,
+		},
+		"Missing File": {
+			Sources:        []app.Source{&app.FileSource{Path: filepath.Join(dir, "missing.json")}},
+			ExpectedError:  "error reading file: open " + filepath.Join(dir, "missing.json") + ": no such file or directory",
+			ExpectedOutput: &app.Config{},
+		},
+		"Stdin": {
+			Sources:        []app.Source{&app.ReaderSource{Reader: strings.NewReader(`{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.0.0.0/16"}]}`)}},
+			ExpectedError:  "",
+			ExpectedOutput: expected,
+		},
+		"Malformed Stdin": {
+			Sources:        []app.Source{&app.ReaderSource{Reader: strings.NewReader(`{"protocols":{}}`)}},
+			ExpectedError:  "malformed stdin",
+			ExpectedOutput: &app.Config{},
+		},
+		"Overlay": {
+			Sources: []app.Source{
+				&app.ReaderSource{Reader: strings.NewReader(`{
+	"protocols": {
+		"http": {"transport": "tcp", "from_port": 80, "to_port": 80},
+		"ssh": {"transport": "tcp", "from_port": 22, "to_port": 22}
+	},
+	"rules": [
+		{"cidr": "10.0.0.0/16"},
+		{"cidr": "172.16.0.0/12"}
+	]
+}`)},
+				&app.ReaderSource{Reader: strings.NewReader(`
+protocols:
+  http:
+    transport: tcp
+    from_port: 8080
+    to_port: 8080
+  ssh: null
+rules:
+  - cidr: 10.0.0.0/16
+    remove: true
+  - cidr: 192.168.0.0/16
+`)},
+			},
+			ExpectedError: "",
+			ExpectedOutput: &app.Config{
+				Protocols: map[string]*app.Protocol{
+					"http": {
+						Transport: aws.String("tcp"),
+						FromPort:  aws.Int64(8080),
+						ToPort:    aws.Int64(8080),
+					},
+				},
+				Rules: []*app.Rule{
+					{CIDR: aws.String("172.16.0.0/12")},
+					{CIDR: aws.String("192.168.0.0/16")},
+				},
+			},
+		},
+		"Overlay Removes Everything": {
+			Sources: []app.Source{
+				&app.ReaderSource{Reader: strings.NewReader(`{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.0.0.0/16"}]}`)},
+				&app.ReaderSource{Reader: strings.NewReader(`{"rules":[{"cidr":"10.0.0.0/16","remove":true}]}`)},
+			},
+			ExpectedError:  "malformed configuration",
+			ExpectedOutput: &app.Config{},
+		},
+		"No Sources": {
+			Sources:        nil,
+			ExpectedError:  "no configuration source",
+			ExpectedOutput: &app.Config{},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		result, err := app.LoadConfig(tc.Sources...)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestLoadConfigFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	valid := `{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.0.0.0/16"}]}`
+	current := &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secret),
+		VersionStage: aws.String("AWSCURRENT"),
+	}
+
+	type test struct {
+		Fallback       string
+		MockOutput1    *secretsmanager.GetSecretValueOutput
+		MockError1     error
+		MockInput2     *secretsmanager.GetSecretValueInput
+		MockOutput2    *secretsmanager.GetSecretValueOutput
+		ExpectedError  string
+		ExpectedReport *app.Report
+	}
+
+	suite := map[string]test{
+		"Previous Version": {
+			Fallback: "AWSPREVIOUS",
+			MockOutput1: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`{invalid json`),
+				VersionId:    aws.String("v2"),
+			},
+			MockInput2: &secretsmanager.GetSecretValueInput{
+				SecretId:     aws.String(secret),
+				VersionStage: aws.String("AWSPREVIOUS"),
+			},
+			MockOutput2: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(valid),
+				VersionId:    aws.String("v1"),
+			},
+			ExpectedError: "",
+			ExpectedReport: &app.Report{
+				Sources: []*app.SourceReport{
+					{Source: "secret:" + secret, Version: "v1", Fallback: true},
+				},
+			},
+		},
+		"Pinned Version": {
+			Fallback: "01234567-89ab-cdef-0123-456789abcdef",
+			MockOutput1: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`{"rules":[]}`),
+				VersionId:    aws.String("v2"),
+			},
+			MockInput2: &secretsmanager.GetSecretValueInput{
+				SecretId:  aws.String(secret),
+				VersionId: aws.String("01234567-89ab-cdef-0123-456789abcdef"),
+			},
+			MockOutput2: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(valid),
+				VersionId:    aws.String("01234567-89ab-cdef-0123-456789abcdef"),
+			},
+			ExpectedError: "",
+			ExpectedReport: &app.Report{
+				Sources: []*app.SourceReport{
+					{Source: "secret:" + secret, Version: "01234567-89ab-cdef-0123-456789abcdef", Fallback: true},
+				},
+			},
+		},
+		"Current Version Valid": {
+			Fallback: "AWSPREVIOUS",
+			MockOutput1: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(valid),
+				VersionId:    aws.String("v2"),
+			},
+			ExpectedError: "",
+			ExpectedReport: &app.Report{
+				Sources: []*app.SourceReport{
+					{Source: "secret:" + secret, Version: "v2"},
+				},
+			},
+		},
+		"Fallback Invalid": {
+			Fallback: "AWSPREVIOUS",
+			MockOutput1: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`{"rules":[]}`),
+			},
+			MockInput2: &secretsmanager.GetSecretValueInput{
+				SecretId:     aws.String(secret),
+				VersionStage: aws.String("AWSPREVIOUS"),
+			},
+			MockOutput2: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`{"protocols":{}}`),
+			},
+			ExpectedError: "error loading fallback configuration of secret:secret: malformed secret",
+		},
+		"API Failure Does Not Fall Back": {
+			Fallback:      "AWSPREVIOUS",
+			MockOutput1:   &secretsmanager.GetSecretValueOutput{},
+			MockError1:    errors.New("reason"),
+			ExpectedError: "error fetching secret: reason",
+		},
+		"No Fallback Configured": {
+			Fallback: "",
+			MockOutput1: &secretsmanager.GetSecretValueOutput{
+				SecretString: aws.String(`{invalid json`),
+			},
+			ExpectedError: "error parsing secret: invalid character 'i' looking for beginning of object key string",
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.SM)
+		m.On("GetSecretValue", current).Return(tc.MockOutput1, tc.MockError1).Once()
+		if tc.MockInput2 != nil {
+			m.On("GetSecretValue", tc.MockInput2).Return(tc.MockOutput2, nil).Once()
+		}
+
+		src := &app.SecretSource{Client: m, Secret: secret, Fallback: tc.Fallback}
+		_, err := app.LoadConfig(src)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedReport, app.NewReport(src))
+		}
+
+		m.AssertExpectations(t)
+	}
+}
+
+func TestLoadConfigOverlayFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	previous := &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secret),
+		VersionStage: aws.String("AWSPREVIOUS"),
+	}
+
+	type test struct {
+		Stdin          string
+		Current        string
+		Previous       string
+		ExpectedError  string
+		ExpectedRules  []string
+		ExpectedReport *app.Report
+	}
+
+	suite := map[string]test{
+		"Invalid Secret Falls Back Alone": {
+			Stdin:         `{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.1.0.0/16"}]}`,
+			Current:       `{invalid json`,
+			Previous:      `{"rules":[{"cidr":"10.0.0.0/16"}]}`,
+			ExpectedError: "",
+			ExpectedRules: []string{"10.1.0.0/16", "10.0.0.0/16"},
+			ExpectedReport: &app.Report{
+				Sources: []*app.SourceReport{
+					{Source: "stdin"},
+					{Source: "secret:" + secret, Version: "v1", Fallback: true},
+				},
+			},
+		},
+		"Invalid Merged Configuration": {
+			Stdin:         `{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}}}`,
+			Current:       `{"tag_key":"invalid key"}`,
+			Previous:      `{"rules":[{"cidr":"10.0.0.0/16"}]}`,
+			ExpectedError: "",
+			ExpectedRules: []string{"10.0.0.0/16"},
+			ExpectedReport: &app.Report{
+				Sources: []*app.SourceReport{
+					{Source: "stdin"},
+					{Source: "secret:" + secret, Version: "v1", Fallback: true},
+				},
+			},
+		},
+		"Invalid Source Without Fallback": {
+			Stdin:         `{invalid json`,
+			Current:       `{"protocols":{"http":{"transport":"tcp","from_port":80,"to_port":80}},"rules":[{"cidr":"10.0.0.0/16"}]}`,
+			ExpectedError: "error parsing stdin: invalid character 'i' looking for beginning of object key string",
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.SM)
+		m.On("GetSecretValue", &secretsmanager.GetSecretValueInput{
+			SecretId:     aws.String(secret),
+			VersionStage: aws.String("AWSCURRENT"),
+		}).Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String(tc.Current), VersionId: aws.String("v2")}, nil).Once()
+		if tc.Previous != "" {
+			m.On("GetSecretValue", previous).Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String(tc.Previous), VersionId: aws.String("v1")}, nil).Once()
+		}
+
+		stdin := &app.ReaderSource{Reader: strings.NewReader(tc.Stdin)}
+		src := &app.SecretSource{Client: m, Secret: secret, Fallback: "AWSPREVIOUS"}
+
+		c, err := app.LoadConfig(stdin, src)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+
+			rules := make([]string, 0)
+			for _, rule := range c.Rules {
+				rules = append(rules, aws.StringValue(rule.CIDR))
+			}
+			assert.Equal(tc.ExpectedRules, rules)
+			assert.Equal(tc.ExpectedReport, app.NewReport(stdin, src))
+		}
+
+		m.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// DefaultRoleTemplate is the default role of discovered accounts,
+// where "{account}" is replaced with the account ID
+const DefaultRoleTemplate = "arn:aws:iam::{account}:role/security-group-manager"
+
+// Discovery lists active accounts from AWS Organizations, optionally limited to
+// organizational units (including nested ones) and to accounts having all Tags.
+// RoleARN is a template of the role to assume in every discovered account.
+type Discovery struct {
+	OUs        []string          `json:"ous,omitempty" yaml:"ous,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	RoleARN    string            `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+	ExternalID string            `json:"external_id,omitempty" yaml:"external_id,omitempty"`
+}
+
+// OrganizationsClient represents an AWS Organizations client
+type OrganizationsClient interface {
+	ListAccounts(*organizations.ListAccountsInput) (*organizations.ListAccountsOutput, error)
+	ListAccountsForParent(*organizations.ListAccountsForParentInput) (*organizations.ListAccountsForParentOutput, error)
+	ListChildren(*organizations.ListChildrenInput) (*organizations.ListChildrenOutput, error)
+	ListTagsForResource(*organizations.ListTagsForResourceInput) (*organizations.ListTagsForResourceOutput, error)
+}
+
+// Discover appends accounts discovered in AWS Organizations to the Accounts of
+// a Config (receiver). Accounts which are already listed are kept as they are.
+// A restore does not call AWS Organizations, it appends the accounts of the Snapshot.
+func (c *Config) Discover(cli OrganizationsClient) error {
+	if c.Discovery == nil {
+		return nil
+	}
+
+	var accounts []*organizations.Account
+	if c.restore != nil {
+		accounts = c.restoredAccounts()
+	} else {
+		var err error
+		accounts, err = c.Discovery.accounts(cli)
+		if err != nil {
+			return errors.Wrap(err, "error discovering accounts")
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, account := range c.Accounts {
+		if id := account.ID(); id != "" {
+			listed[id] = true
+		}
+	}
+
+	for _, account := range accounts {
+		id := aws.StringValue(account.Id)
+		if listed[id] {
+			continue
+		}
+
+		// accounts of a snapshot were tagged when it was taken
+		if c.restore == nil {
+			if ok, err := c.Discovery.tagged(cli, id); err != nil {
+				return errors.Wrapf(err, "error fetching tags of account '%s'", id)
+			} else if !ok {
+				continue
+			}
+		}
+
+		listed[id] = true
+		c.Accounts = append(c.Accounts, &Account{
+			RoleARN:    strings.ReplaceAll(c.Discovery.roleTemplate(), "{account}", id),
+			ExternalID: c.Discovery.ExternalID,
+		})
+
+		logger.WithField("account", id).Debugf("discovered account '%s'", aws.StringValue(account.Name))
+	}
+
+	logger.Infof("managing %v accounts", len(c.Accounts))
+
+	return nil
+}
+
+// restoredAccounts returns the accounts of the security groups of the restored Snapshot
+func (c *Config) restoredAccounts() []*organizations.Account {
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, g := range c.restore {
+		if g.Account != "" && !seen[g.Account] {
+			seen[g.Account] = true
+			ids = append(ids, g.Account)
+		}
+	}
+	sort.Strings(ids)
+
+	l := make([]*organizations.Account, 0, len(ids))
+	for _, id := range ids {
+		l = append(l, &organizations.Account{Id: aws.String(id), Name: aws.String(id)})
+	}
+
+	return l
+}
+
+// accounts returns active accounts of the organization or of the OUs of a Discovery (receiver)
+func (d *Discovery) accounts(cli OrganizationsClient) ([]*organizations.Account, error) {
+	l := []*organizations.Account{}
+
+	if len(d.OUs) == 0 {
+		var token *string
+		for {
+			o, err := cli.ListAccounts(&organizations.ListAccountsInput{
+				NextToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			l = append(l, o.Accounts...)
+
+			if o.NextToken == nil {
+				break
+			}
+			token = o.NextToken
+		}
+
+		return active(l), nil
+	}
+
+	units, err := d.units(cli)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, unit := range units {
+		var token *string
+		for {
+			o, err := cli.ListAccountsForParent(&organizations.ListAccountsForParentInput{
+				ParentId:  aws.String(unit),
+				NextToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			l = append(l, o.Accounts...)
+
+			if o.NextToken == nil {
+				break
+			}
+			token = o.NextToken
+		}
+	}
+
+	return active(l), nil
+}
+
+// units returns the OUs of a Discovery (receiver) and all nested OUs
+func (d *Discovery) units(cli OrganizationsClient) ([]string, error) {
+	units := append([]string{}, d.OUs...)
+
+	for i := 0; i < len(units); i++ {
+		var token *string
+		for {
+			o, err := cli.ListChildren(&organizations.ListChildrenInput{
+				ParentId:  aws.String(units[i]),
+				ChildType: aws.String(organizations.ChildTypeOrganizationalUnit),
+				NextToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, child := range o.Children {
+				units = append(units, aws.StringValue(child.Id))
+			}
+
+			if o.NextToken == nil {
+				break
+			}
+			token = o.NextToken
+		}
+	}
+
+	return units, nil
+}
+
+// tagged reports whether an account has all Tags of a Discovery (receiver)
+func (d *Discovery) tagged(cli OrganizationsClient, id string) (bool, error) {
+	if len(d.Tags) == 0 {
+		return true, nil
+	}
+
+	tags := make(map[string]string)
+	var token *string
+	for {
+		o, err := cli.ListTagsForResource(&organizations.ListTagsForResourceInput{
+			ResourceId: aws.String(id),
+			NextToken:  token,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		for _, tag := range o.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+
+		if o.NextToken == nil {
+			break
+		}
+		token = o.NextToken
+	}
+
+	for key, value := range d.Tags {
+		if tags[key] != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// roleTemplate returns the role template of a Discovery (receiver)
+func (d *Discovery) roleTemplate() string {
+	if d.RoleARN == "" {
+		return DefaultRoleTemplate
+	}
+
+	return d.RoleARN
+}
+
+// validate the role template of a Discovery (receiver)
+func (d *Discovery) validate() error {
+	if d == nil {
+		return nil
+	}
+
+	if !strings.Contains(d.roleTemplate(), "{account}") {
+		return errors.Errorf("invalid discovery role_arn '%s', expected an '{account}' placeholder", d.RoleARN)
+	}
+
+	return nil
+}
+
+func active(accounts []*organizations.Account) []*organizations.Account {
+	l := make([]*organizations.Account, 0, len(accounts))
+	for _, account := range accounts {
+		if aws.StringValue(account.Status) == organizations.AccountStatusActive {
+			l = append(l, account)
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,178 @@
+package app_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func TestDiscover(t *testing.T) {
+	assert := assert.New(t)
+
+	account := func(id, status string) *organizations.Account {
+		return &organizations.Account{
+			Id:     aws.String(id),
+			Name:   aws.String("account-" + id),
+			Status: aws.String(status),
+		}
+	}
+
+	type test struct {
+		Discovery        *app.Discovery
+		Accounts         []*app.Account
+		Snapshot         *app.Snapshot
+		Mock             func(m *mocks.Organizations)
+		ExpectedError    string
+		ExpectedAccounts []*app.Account
+	}
+
+	suite := map[string]test{
+		"Organization": {
+			Discovery: &app.Discovery{},
+			Accounts: []*app.Account{
+				{Name: "111111111111", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+			},
+			Mock: func(m *mocks.Organizations) {
+				m.On("ListAccounts", &organizations.ListAccountsInput{}).Return(&organizations.ListAccountsOutput{
+					Accounts:  []*organizations.Account{account("111111111111", "ACTIVE"), account("222222222222", "ACTIVE")},
+					NextToken: aws.String("token"),
+				}, nil).Once()
+				m.On("ListAccounts", &organizations.ListAccountsInput{NextToken: aws.String("token")}).Return(&organizations.ListAccountsOutput{
+					Accounts: []*organizations.Account{account("333333333333", "SUSPENDED")},
+				}, nil).Once()
+			},
+			ExpectedError: "",
+			ExpectedAccounts: []*app.Account{
+				{Name: "111111111111", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+				{RoleARN: "arn:aws:iam::222222222222:role/security-group-manager"},
+			},
+		},
+		"Named Account": {
+			Discovery: &app.Discovery{},
+			Accounts: []*app.Account{
+				{Name: "production", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+			},
+			Mock: func(m *mocks.Organizations) {
+				m.On("ListAccounts", &organizations.ListAccountsInput{}).Return(&organizations.ListAccountsOutput{
+					Accounts: []*organizations.Account{account("111111111111", "ACTIVE")},
+				}, nil).Once()
+			},
+			ExpectedError: "",
+			ExpectedAccounts: []*app.Account{
+				{Name: "production", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+			},
+		},
+		"Nested OUs And Tags": {
+			Discovery: &app.Discovery{
+				OUs:        []string{"ou-1"},
+				Tags:       map[string]string{"sgm": "enabled"},
+				RoleARN:    "arn:aws:iam::{account}:role/sgm",
+				ExternalID: "secret",
+			},
+			Mock: func(m *mocks.Organizations) {
+				m.On("ListChildren", &organizations.ListChildrenInput{
+					ParentId:  aws.String("ou-1"),
+					ChildType: aws.String("ORGANIZATIONAL_UNIT"),
+				}).Return(&organizations.ListChildrenOutput{
+					Children: []*organizations.Child{{Id: aws.String("ou-2")}},
+				}, nil).Once()
+				m.On("ListChildren", &organizations.ListChildrenInput{
+					ParentId:  aws.String("ou-2"),
+					ChildType: aws.String("ORGANIZATIONAL_UNIT"),
+				}).Return(&organizations.ListChildrenOutput{}, nil).Once()
+				m.On("ListAccountsForParent", &organizations.ListAccountsForParentInput{ParentId: aws.String("ou-1")}).Return(&organizations.ListAccountsForParentOutput{
+					Accounts: []*organizations.Account{account("111111111111", "ACTIVE")},
+				}, nil).Once()
+				m.On("ListAccountsForParent", &organizations.ListAccountsForParentInput{ParentId: aws.String("ou-2")}).Return(&organizations.ListAccountsForParentOutput{
+					Accounts: []*organizations.Account{account("222222222222", "ACTIVE")},
+				}, nil).Once()
+				m.On("ListTagsForResource", &organizations.ListTagsForResourceInput{ResourceId: aws.String("111111111111")}).Return(&organizations.ListTagsForResourceOutput{
+					Tags: []*organizations.Tag{{Key: aws.String("sgm"), Value: aws.String("disabled")}},
+				}, nil).Once()
+				m.On("ListTagsForResource", &organizations.ListTagsForResourceInput{ResourceId: aws.String("222222222222")}).Return(&organizations.ListTagsForResourceOutput{
+					Tags: []*organizations.Tag{{Key: aws.String("sgm"), Value: aws.String("enabled")}},
+				}, nil).Once()
+			},
+			ExpectedError: "",
+			ExpectedAccounts: []*app.Account{
+				{RoleARN: "arn:aws:iam::222222222222:role/sgm", ExternalID: "secret"},
+			},
+		},
+		"Restore": {
+			Discovery: &app.Discovery{Tags: map[string]string{"sgm": "enabled"}},
+			Accounts: []*app.Account{
+				{Name: "production", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+			},
+			Snapshot: &app.Snapshot{
+				Groups: []*app.GroupSnapshot{
+					{Account: "222222222222", Region: "us-east-1", Group: "sg-2"},
+					{Account: "111111111111", Region: "us-east-1", Group: "sg-1"},
+					{Account: "222222222222", Region: "us-west-2", Group: "sg-3"},
+				},
+			},
+			Mock:          func(m *mocks.Organizations) {},
+			ExpectedError: "",
+			ExpectedAccounts: []*app.Account{
+				{Name: "production", RoleARN: "arn:aws:iam::111111111111:role/custom"},
+				{RoleARN: "arn:aws:iam::222222222222:role/security-group-manager"},
+			},
+		},
+		"Failure": {
+			Discovery: &app.Discovery{},
+			Mock: func(m *mocks.Organizations) {
+				m.On("ListAccounts", &organizations.ListAccountsInput{}).Return(nil, errors.New("reason")).Once()
+			},
+			ExpectedError:    "error discovering accounts: reason",
+			ExpectedAccounts: nil,
+		},
+		"Disabled": {
+			Discovery:        nil,
+			Mock:             func(m *mocks.Organizations) {},
+			ExpectedError:    "",
+			ExpectedAccounts: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.Organizations)
+		tc.Mock(m)
+
+		c := &app.Config{
+			Accounts:  tc.Accounts,
+			Discovery: tc.Discovery,
+		}
+		if tc.Snapshot != nil {
+			c.Restore(tc.Snapshot)
+		}
+
+		err := c.Discover(m)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedAccounts, c.Accounts)
+		}
+
+		m.AssertExpectations(t)
+	}
+}
+
+func TestLoadInvalidDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"discovery":{"role_arn":"arn:aws:iam::111111111111:role/sgm"},"protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid discovery role_arn 'arn:aws:iam::111111111111:role/sgm', expected an '{account}' placeholder")
+}
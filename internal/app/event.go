@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// SessionName is the session name of roles assumed by this application,
+// changes made in such sessions do not trigger a remediation
+const SessionName = "security-group-manager"
+
+// ChangeEvents are CloudTrail events triggering the remediation of a security group
+var ChangeEvents = []string{
+	"AuthorizeSecurityGroupIngress",
+	"RevokeSecurityGroupIngress",
+	"ModifySecurityGroupRules",
+	"CreateTags",
+}
+
+// Change is a change of security groups recorded by CloudTrail
+type Change struct {
+	Event   string   `json:"event"`
+	Region  string   `json:"region"`
+	Account string   `json:"account"`
+	Actor   string   `json:"actor,omitempty"`
+	Groups  []string `json:"groups"`
+}
+
+type eventBridgeEvent struct {
+	Source     string          `json:"source"`
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+type cloudTrailEvent struct {
+	EventName          string `json:"eventName"`
+	AWSRegion          string `json:"awsRegion"`
+	RecipientAccountID string `json:"recipientAccountId"`
+	UserIdentity       struct {
+		ARN string `json:"arn"`
+	} `json:"userIdentity"`
+	RequestParameters struct {
+		GroupID string `json:"groupId"`
+		Modify  struct {
+			GroupID string `json:"GroupId"`
+		} `json:"ModifySecurityGroupRulesRequest"`
+		ResourcesSet struct {
+			Items []struct {
+				ResourceID string `json:"resourceId"`
+			} `json:"items"`
+		} `json:"resourcesSet"`
+	} `json:"requestParameters"`
+}
+
+// ParseChange returns the Change of an EventBridge event, ok is false for
+// other events (e.g. scheduled ones or unsupported CloudTrail events)
+// which should trigger a full run
+func ParseChange(data []byte) (change *Change, ok bool, err error) {
+	if len(strings.TrimSpace(string(data))) == 0 || string(data) == "null" {
+		return nil, false, nil
+	}
+
+	var e eventBridgeEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing event")
+	}
+
+	if e.Source != "aws.ec2" || e.DetailType != "AWS API Call via CloudTrail" {
+		return nil, false, nil
+	}
+
+	var trail cloudTrailEvent
+	if err := json.Unmarshal(e.Detail, &trail); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing cloudtrail event")
+	}
+
+	if !isChangeEvent(trail.EventName) {
+		logger.Warnf("unsupported cloudtrail event '%s', reconciling all security groups", trail.EventName)
+		return nil, false, nil
+	}
+
+	found := make(map[string]bool)
+	for _, id := range []string{trail.RequestParameters.GroupID, trail.RequestParameters.Modify.GroupID} {
+		found[id] = true
+	}
+	for _, item := range trail.RequestParameters.ResourcesSet.Items {
+		found[item.ResourceID] = true
+	}
+
+	groups := make([]string, 0, len(found))
+	for id := range found {
+		if strings.HasPrefix(id, "sg-") {
+			groups = append(groups, id)
+		}
+	}
+	sort.Strings(groups)
+
+	return &Change{
+		Event:   trail.EventName,
+		Region:  trail.AWSRegion,
+		Account: trail.RecipientAccountID,
+		Actor:   trail.UserIdentity.ARN,
+		Groups:  groups,
+	}, true, nil
+}
+
+// Own reports whether a Change (receiver) was made by this application,
+// i.e. in a session of SessionName or of one of the given session names
+func (ch *Change) Own(sessions ...string) bool {
+	for _, session := range append([]string{SessionName}, sessions...) {
+		if session != "" && strings.HasSuffix(ch.Actor, "/"+session) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isChangeEvent(name string) bool {
+	for _, event := range ChangeEvents {
+		if event == name {
+			return true
+		}
+	}
+
+	return false
+}
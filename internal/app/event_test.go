@@ -0,0 +1,165 @@
+package app_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func trailEvent(name, parameters string) string {
+	return `{
+		"source": "aws.ec2",
+		"detail-type": "AWS API Call via CloudTrail",
+		"detail": {
+			"eventName": "` + name + `",
+			"awsRegion": "us-west-2",
+			"recipientAccountId": "111111111111",
+			"userIdentity": {"arn": "arn:aws:sts::111111111111:assumed-role/admin/jane"},
+			"requestParameters": ` + parameters + `
+		}
+	}`
+}
+
+func TestParseChange(t *testing.T) {
+	assert := assert.New(t)
+
+	change := func(event string, groups ...string) *app.Change {
+		return &app.Change{
+			Event:   event,
+			Region:  "us-west-2",
+			Account: "111111111111",
+			Actor:   "arn:aws:sts::111111111111:assumed-role/admin/jane",
+			Groups:  groups,
+		}
+	}
+
+	type test struct {
+		Event          string
+		ExpectedOK     bool
+		ExpectedError  string
+		ExpectedOutput *app.Change
+	}
+
+	suite := map[string]test{
+		"Authorize": {
+			Event:          trailEvent("AuthorizeSecurityGroupIngress", `{"groupId": "sg-1"}`),
+			ExpectedOK:     true,
+			ExpectedError:  "",
+			ExpectedOutput: change("AuthorizeSecurityGroupIngress", "sg-1"),
+		},
+		"Revoke": {
+			Event:          trailEvent("RevokeSecurityGroupIngress", `{"groupId": "sg-1"}`),
+			ExpectedOK:     true,
+			ExpectedError:  "",
+			ExpectedOutput: change("RevokeSecurityGroupIngress", "sg-1"),
+		},
+		"Modify": {
+			Event:          trailEvent("ModifySecurityGroupRules", `{"ModifySecurityGroupRulesRequest": {"GroupId": "sg-2"}}`),
+			ExpectedOK:     true,
+			ExpectedError:  "",
+			ExpectedOutput: change("ModifySecurityGroupRules", "sg-2"),
+		},
+		"Create Tags": {
+			Event:          trailEvent("CreateTags", `{"resourcesSet": {"items": [{"resourceId": "sg-3"}, {"resourceId": "i-1"}, {"resourceId": "sg-1"}]}}`),
+			ExpectedOK:     true,
+			ExpectedError:  "",
+			ExpectedOutput: change("CreateTags", "sg-1", "sg-3"),
+		},
+		"Scheduled": {
+			Event:          `{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`,
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+		"Empty": {
+			Event:          "",
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+		"Unsupported": {
+			Event:          trailEvent("DeleteSecurityGroup", `{"groupId": "sg-1"}`),
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		result, ok, err := app.ParseChange([]byte(tc.Event))
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOK, ok)
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestOwnChange(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True((&app.Change{Actor: "arn:aws:sts::111111111111:assumed-role/sgm/" + app.SessionName}).Own())
+	assert.True((&app.Change{Actor: "arn:aws:sts::111111111111:assumed-role/lambda-role/sgm-function"}).Own("sgm-function"))
+	assert.False((&app.Change{Actor: "arn:aws:sts::111111111111:assumed-role/admin/jane"}).Own(""))
+}
+
+func TestRunGroups(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {
+				Transport: aws.String("tcp"),
+				FromPort:  aws.Int64(22),
+				ToPort:    aws.Int64(22),
+			},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", &ec2.DescribeSecurityGroupsInput{
+		MaxResults: aws.Int64(100),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String("ssh")},
+			},
+			{
+				Name:   aws.String("group-id"),
+				Values: []*string{aws.String("sg-1")},
+			},
+		},
+	}).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	assert.NoError(c.RunGroups(m, []string{"sg-1"}))
+	assert.NoError(c.RunGroups(m, nil))
+
+	m.AssertExpectations(t)
+}
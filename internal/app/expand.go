@@ -0,0 +1,162 @@
+package app
+
+import (
+	"net"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Expand replaces feed and host rules of a Config (receiver) and of its
+// rule sets with a rule per CIDR. Inactive rules are dropped and duplicate
+// CIDRs are reconciled only once.
+//
+// A host which cannot be resolved, or a feed which cannot be fetched, and was
+// never resolved before does not fail the run, instead incorrect rules it may
+// have provided (any CIDR of a feed, single addresses of a host) are kept on
+// the security groups whose rules include it, until it resolves again.
+// Nothing is expanded by a restore, which does not use the rules.
+func (c *Config) Expand(feeds *FeedCache, hosts *HostCache) error {
+	c.unresolved = make(map[string][]*Rule)
+	if c.restore != nil {
+		return nil
+	}
+
+	rules, err := c.expand("", c.Rules, feeds, hosts)
+	if err != nil {
+		return err
+	}
+	c.Rules = rules
+
+	for name, set := range c.RuleSets {
+		rules, err := c.expand(name, set, feeds, hosts)
+		if err != nil {
+			return errors.Wrapf(err, "error expanding rule set '%s'", name)
+		}
+		c.RuleSets[name] = rules
+	}
+
+	return nil
+}
+
+// expand the rules of a rule set, or the rules of a Config (receiver) when the set is empty
+func (c *Config) expand(set string, all []*Rule, feeds *FeedCache, hosts *HostCache) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(all))
+	seen := make(map[string]bool)
+
+	add := func(r *Rule) {
+		if seen[*r.CIDR] {
+			return
+		}
+		seen[*r.CIDR] = true
+		rules = append(rules, r)
+	}
+
+	for _, rule := range c.active(all) {
+		switch {
+		case rule.Feed != nil:
+			cidrs, err := feeds.Expand(rule.Feed)
+			if _, ok := err.(unavailable); ok {
+				logger.WithError(err).Errorf("feed '%s' could not be fetched, incorrect cidrs will be kept", rule.Feed.URL)
+				c.unresolved[set] = append(c.unresolved[set], rule)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			logger.Debugf("feed '%s' with filter '%s' expanded to %v cidrs", rule.Feed.URL, rule.Feed.Filter, len(cidrs))
+
+			for _, cidr := range cidrs {
+				add(rule.withCIDR(cidr))
+			}
+		case rule.Host != "":
+			cidrs, err := hosts.Resolve(rule.Host)
+			if err != nil {
+				logger.WithError(err).Errorf("host '%s' could not be resolved, incorrect cidrs will be kept", rule.Host)
+				c.unresolved[set] = append(c.unresolved[set], rule)
+				continue
+			}
+
+			logger.Debugf("host '%s' resolved to %v", rule.Host, cidrs)
+
+			for _, cidr := range cidrs {
+				add(rule.withCIDR(cidr))
+			}
+		case rule.CIDR != nil:
+			add(rule)
+		default:
+			return nil, errors.New("rule has neither a cidr, a feed nor a host")
+		}
+	}
+
+	return rules, nil
+}
+
+// preserved reports whether an incorrect CIDR of a security group is kept
+// because it may come from a rule applied to it which could not be resolved:
+// any CIDR may come from a feed, a single address from a host
+func (c *Config) preserved(group *ec2.SecurityGroup, cidr string) bool {
+	sets := []string{""}
+	exclude := make(map[string]bool)
+	if !c.ignoreOverrides {
+		sets = append(sets, tagList(group, c.overrideTag(TagExtra))...)
+		exclude = c.excluded(group)
+	}
+
+	for _, set := range sets {
+		for _, rule := range c.unresolved[set] {
+			if rule.Name != "" && exclude[rule.Name] {
+				continue
+			}
+
+			if rule.Feed != nil || (rule.Host != "" && single(cidr)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// withCIDR returns a plain CIDR rule expanded from a rule (receiver)
+func (r *Rule) withCIDR(cidr string) *Rule {
+	return &Rule{
+		Name:      r.Name,
+		CIDR:      aws.String(cidr),
+		Note:      r.Note,
+		NotBefore: r.NotBefore,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+// single reports whether a CIDR is a single address
+func single(cidr string) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+
+	ones, bits := network.Mask.Size()
+
+	return ones == bits
+}
+
+// normalizeCIDR returns a canonical CIDR of a CIDR or a bare
+// address, which becomes a /32 (IPv4) or /128 (IPv6) network
+func normalizeCIDR(s string) (string, bool) {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", true
+		}
+		return ip.String() + "/128", true
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", false
+	}
+
+	return network.String(), true
+}
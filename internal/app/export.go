@@ -1,7 +1,14 @@
 package app
 
+import "time"
+
 // CategorizeRules is exported for unit test because test are in a sepparate package
 var CategorizeRules = (*Config).categorizeRules
 
 // GetManagedRules is exported for unit test because test are in a sepparate package
 var GetManagedRules = (*Config).getManagedRules
+
+// SetClock is exported for unit test because test are in a sepparate package
+func SetClock(c *Config, now func() time.Time) {
+	c.clock = now
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// DefaultFeedTTL is how long a fetched feed is reused before it is fetched again
+const DefaultFeedTTL = time.Hour
+
+// Feed references a published list of IP ranges, such as AWS ip-ranges.json.
+// Filter is a comma-separated list of 'field=value' terms which must all
+// match a field of an enclosing JSON object (e.g. "service=ROUTE53_HEALTHCHECKS,region=us-east-1").
+// The special term 'key=<name>' matches a JSON object key on the path instead,
+// which selects lists such as GitHub's "hooks" or Cloudflare's "ipv4_cidrs".
+// Feeds which are not JSON are read as one CIDR per line.
+type Feed struct {
+	URL    string `json:"url" yaml:"url"`
+	Filter string `json:"filter,omitempty" yaml:"filter,omitempty"`
+}
+
+// HTTPClient represents an HTTP client
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// FeedCache keeps fetched feeds between invocations of a warm Lambda.
+// When a feed cannot be fetched, its previous content is used instead.
+type FeedCache struct {
+	Client HTTPClient
+	TTL    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*feedEntry
+}
+
+type feedEntry struct {
+	data    []byte
+	fetched time.Time
+}
+
+// NewFeedCache returns an empty FeedCache
+func NewFeedCache(cli HTTPClient, ttl time.Duration) *FeedCache {
+	return &FeedCache{
+		Client:  cli,
+		TTL:     ttl,
+		entries: make(map[string]*feedEntry),
+	}
+}
+
+// unavailable is the error of a feed which failed to fetch and has no previous version
+type unavailable struct {
+	error
+}
+
+// Expand a Feed into a sorted list of CIDRs
+func (f *FeedCache) Expand(feed *Feed) ([]string, error) {
+	data, err := f.get(feed.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	cidrs, err := parseFeed(data, feed.Filter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing feed '%s'", feed.URL)
+	}
+
+	if len(cidrs) == 0 {
+		return nil, errors.Errorf("feed '%s' with filter '%s' matched no cidrs", feed.URL, feed.Filter)
+	}
+
+	return cidrs, nil
+}
+
+func (f *FeedCache) get(url string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry := f.entries[url]
+	if entry != nil && time.Since(entry.fetched) < f.TTL {
+		return entry.data, nil
+	}
+
+	data, err := f.fetch(url)
+	if err != nil {
+		if entry != nil {
+			logger.WithError(err).Warnf("error fetching feed '%s', keeping the previous version", url)
+			return entry.data, nil
+		}
+		return nil, unavailable{err}
+	}
+
+	f.entries[url] = &feedEntry{
+		data:    data,
+		fetched: time.Now(),
+	}
+
+	return data, nil
+}
+
+func (f *FeedCache) fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching feed '%s'", url)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching feed '%s'", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error fetching feed '%s': unexpected status '%s'", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading feed '%s'", url)
+	}
+
+	return data, nil
+}
+
+// parseFeed returns sorted CIDRs of a feed matching a filter
+func parseFeed(data []byte, filter string) ([]string, error) {
+	terms, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err == nil {
+		walkFeed(doc, terms, make([]bool, len(terms)), found)
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if cidr, ok := normalizeCIDR(strings.TrimSpace(scanner.Text())); ok {
+				found[cidr] = true
+			}
+		}
+	}
+
+	cidrs := make([]string, 0, len(found))
+	for cidr := range found {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	return cidrs, nil
+}
+
+type filterTerm struct {
+	field string
+	value string
+}
+
+func parseFilter(filter string) ([]filterTerm, error) {
+	terms := make([]filterTerm, 0)
+
+	for _, term := range strings.Split(filter, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		field, value, ok := strings.Cut(term, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid filter term '%s', expected 'field=value'", term)
+		}
+
+		terms = append(terms, filterTerm{
+			field: strings.TrimSpace(field),
+			value: strings.TrimSpace(value),
+		})
+	}
+
+	return terms, nil
+}
+
+// walkFeed collects CIDR strings below a node once every filter term
+// is matched by an enclosing object
+func walkFeed(node interface{}, terms []filterTerm, matched []bool, found map[string]bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		matched = append([]bool{}, matched...)
+		for i, term := range terms {
+			if v, ok := n[term.field].(string); ok && strings.EqualFold(v, term.value) {
+				matched[i] = true
+			}
+		}
+
+		for key, child := range n {
+			m := matched
+			for i, term := range terms {
+				if term.field == "key" && term.value == key && !m[i] {
+					m = append([]bool{}, m...)
+					m[i] = true
+				}
+			}
+			walkFeed(child, terms, m, found)
+		}
+	case []interface{}:
+		for _, child := range n {
+			walkFeed(child, terms, matched, found)
+		}
+	case string:
+		for _, ok := range matched {
+			if !ok {
+				return
+			}
+		}
+
+		if cidr, ok := normalizeCIDR(n); ok {
+			found[cidr] = true
+		}
+	}
+}
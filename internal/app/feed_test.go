@@ -0,0 +1,193 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+)
+
+const ipRanges string = `{
+	"syncToken": "1700000000",
+	"prefixes": [
+		{"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON"},
+		{"ip_prefix": "54.243.31.192/26", "region": "us-east-1", "service": "ROUTE53_HEALTHCHECKS"},
+		{"ip_prefix": "107.23.255.0/26", "region": "us-east-1", "service": "ROUTE53_HEALTHCHECKS"},
+		{"ip_prefix": "54.183.255.128/26", "region": "us-west-1", "service": "ROUTE53_HEALTHCHECKS"}
+	],
+	"ipv6_prefixes": [
+		{"ipv6_prefix": "2600:1f1c:7ff:f800::/53", "region": "us-east-1", "service": "ROUTE53_HEALTHCHECKS"}
+	]
+}`
+
+const meta string = `{
+	"verifiable_password_authentication": false,
+	"hooks": ["192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29"],
+	"web": ["140.82.112.0/20"]
+}`
+
+func TestExpand(t *testing.T) {
+	assert := assert.New(t)
+
+	var failing bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/ip-ranges.json":
+			_, _ = w.Write([]byte(ipRanges))
+		case "/meta":
+			_, _ = w.Write([]byte(meta))
+		case "/ips-v4":
+			_, _ = w.Write([]byte("173.245.48.0/20\n103.21.244.0/22\n\n198.51.100.7\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	type test struct {
+		Rules          []*app.Rule
+		Cached         bool
+		Failing        bool
+		ExpectedError  string
+		ExpectedOutput []*app.Rule
+	}
+
+	suite := map[string]test{
+		"AWS IP Ranges": {
+			Rules: []*app.Rule{
+				{Feed: &app.Feed{URL: server.URL + "/ip-ranges.json", Filter: "service=ROUTE53_HEALTHCHECKS, region=us-east-1"}},
+			},
+			ExpectedError: "",
+			ExpectedOutput: []*app.Rule{
+				{CIDR: aws.String("107.23.255.0/26")},
+				{CIDR: aws.String("2600:1f1c:7ff:f800::/53")},
+				{CIDR: aws.String("54.243.31.192/26")},
+			},
+		},
+		"Key Filter": {
+			Rules: []*app.Rule{
+				{Feed: &app.Feed{URL: server.URL + "/meta", Filter: "key=hooks"}},
+			},
+			ExpectedError: "",
+			ExpectedOutput: []*app.Rule{
+				{CIDR: aws.String("185.199.108.0/22")},
+				{CIDR: aws.String("192.30.252.0/22")},
+				{CIDR: aws.String("2a0a:a440::/29")},
+			},
+		},
+		"Plain Text With Static Duplicate": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("103.21.244.0/22")},
+				{Feed: &app.Feed{URL: server.URL + "/ips-v4"}},
+			},
+			ExpectedError: "",
+			ExpectedOutput: []*app.Rule{
+				{CIDR: aws.String("103.21.244.0/22")},
+				{CIDR: aws.String("173.245.48.0/20")},
+				{CIDR: aws.String("198.51.100.7/32")},
+			},
+		},
+		"No Match": {
+			Rules: []*app.Rule{
+				{Feed: &app.Feed{URL: server.URL + "/ip-ranges.json", Filter: "service=UNKNOWN"}},
+			},
+			ExpectedError:  "feed '" + server.URL + "/ip-ranges.json' with filter 'service=UNKNOWN' matched no cidrs",
+			ExpectedOutput: nil,
+		},
+		"Invalid Filter": {
+			Rules: []*app.Rule{
+				{Feed: &app.Feed{URL: server.URL + "/meta", Filter: "hooks"}},
+			},
+			ExpectedError:  "error parsing feed '" + server.URL + "/meta': invalid filter term 'hooks', expected 'field=value'",
+			ExpectedOutput: nil,
+		},
+		"Fetch Failure Keeps Static Rules": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16")},
+				{Feed: &app.Feed{URL: server.URL + "/ips-v4"}},
+			},
+			Failing:       true,
+			ExpectedError: "",
+			ExpectedOutput: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16")},
+			},
+		},
+		"Fetch Failure Keeps Previous Expansion": {
+			Rules: []*app.Rule{
+				{Feed: &app.Feed{URL: server.URL + "/meta", Filter: "key=web"}},
+			},
+			Cached:        true,
+			Failing:       true,
+			ExpectedError: "",
+			ExpectedOutput: []*app.Rule{
+				{CIDR: aws.String("140.82.112.0/20")},
+			},
+		},
+		"Rule Without CIDR": {
+			Rules: []*app.Rule{
+				{},
+			},
+			ExpectedError:  "rule has neither a cidr, a feed nor a host",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		feeds := app.NewFeedCache(http.DefaultClient, 0)
+
+		failing = false
+		if tc.Cached {
+			c := &app.Config{Rules: tc.Rules}
+			if err := c.Expand(feeds, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		failing = tc.Failing
+
+		c := &app.Config{Rules: tc.Rules}
+		err := c.Expand(feeds, nil)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedOutput, c.Rules)
+		}
+	}
+}
+
+func TestFeedCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("198.51.100.0/24\n"))
+	}))
+	defer server.Close()
+
+	feeds := app.NewFeedCache(http.DefaultClient, time.Hour)
+	feed := &app.Feed{URL: server.URL}
+
+	for i := 0; i < 3; i++ {
+		cidrs, err := feeds.Expand(feed)
+		assert.NoError(err)
+		assert.Equal([]string{"198.51.100.0/24"}, cidrs)
+	}
+
+	assert.Equal(1, requests)
+}
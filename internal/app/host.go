@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// DefaultHostMinTTL is how long a resolved address is kept after it was last seen
+const DefaultHostMinTTL = 5 * time.Minute
+
+// Resolver represents a DNS resolver such as net.DefaultResolver
+type Resolver interface {
+	LookupIPAddr(context.Context, string) ([]net.IPAddr, error)
+}
+
+// HostCache resolves host rules to /32 and /128 CIDRs.
+// Every address is kept for at least MinTTL after it was last resolved,
+// so round-robin records do not churn rules between invocations, and
+// a failed or empty resolution reuses the previously resolved addresses.
+type HostCache struct {
+	Resolver Resolver
+	MinTTL   time.Duration
+	Timeout  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string]time.Time
+}
+
+// NewHostCache returns an empty HostCache
+func NewHostCache(r Resolver, minTTL time.Duration) *HostCache {
+	return &HostCache{
+		Resolver: r,
+		MinTTL:   minTTL,
+		Timeout:  5 * time.Second,
+		entries:  make(map[string]map[string]time.Time),
+	}
+}
+
+// Resolve a host into a sorted list of CIDRs
+func (h *HostCache) Resolve(host string) ([]string, error) {
+	if h == nil {
+		return nil, errors.Errorf("no resolver for host '%s'", host)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	addrs, err := h.Resolver.LookupIPAddr(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no addresses")
+	}
+
+	seen := h.entries[host]
+	if err != nil {
+		if len(seen) == 0 {
+			return nil, errors.Wrapf(err, "error resolving host '%s'", host)
+		}
+
+		logger.WithError(err).Warnf("error resolving host '%s', keeping the previous addresses", host)
+
+		return sortedKeys(seen), nil
+	}
+
+	if seen == nil {
+		seen = make(map[string]time.Time)
+		h.entries[host] = seen
+	}
+
+	now := time.Now()
+	for _, addr := range addrs {
+		if cidr, ok := normalizeCIDR(addr.IP.String()); ok {
+			seen[cidr] = now
+		}
+	}
+
+	for cidr, last := range seen {
+		if now.Sub(last) > h.MinTTL {
+			delete(seen, cidr)
+		}
+	}
+
+	return sortedKeys(seen), nil
+}
+
+func sortedKeys(m map[string]time.Time) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,218 @@
+package app_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+const host string = "vpn.partner.example"
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	previous := []net.IPAddr{
+		{IP: net.ParseIP("198.51.100.1")},
+	}
+
+	type test struct {
+		Previous       []net.IPAddr
+		MinTTL         time.Duration
+		MockOutput     []net.IPAddr
+		MockError      error
+		ExpectedError  string
+		ExpectedOutput []string
+	}
+
+	suite := map[string]test{
+		"IPv4 And IPv6": {
+			MockOutput: []net.IPAddr{
+				{IP: net.ParseIP("198.51.100.2")},
+				{IP: net.ParseIP("2001:db8::1")},
+			},
+			ExpectedError:  "",
+			ExpectedOutput: []string{"198.51.100.2/32", "2001:db8::1/128"},
+		},
+		"Address Kept For Minimum TTL": {
+			Previous: previous,
+			MinTTL:   time.Hour,
+			MockOutput: []net.IPAddr{
+				{IP: net.ParseIP("198.51.100.2")},
+			},
+			ExpectedError:  "",
+			ExpectedOutput: []string{"198.51.100.1/32", "198.51.100.2/32"},
+		},
+		"Address Dropped After Minimum TTL": {
+			Previous: previous,
+			MinTTL:   0,
+			MockOutput: []net.IPAddr{
+				{IP: net.ParseIP("198.51.100.2")},
+			},
+			ExpectedError:  "",
+			ExpectedOutput: []string{"198.51.100.2/32"},
+		},
+		"Empty Resolution Keeps Previous Addresses": {
+			Previous:       previous,
+			MockOutput:     []net.IPAddr{},
+			ExpectedError:  "",
+			ExpectedOutput: []string{"198.51.100.1/32"},
+		},
+		"Failure Keeps Previous Addresses": {
+			Previous:       previous,
+			MockError:      errors.New("reason"),
+			ExpectedError:  "",
+			ExpectedOutput: []string{"198.51.100.1/32"},
+		},
+		"Failure Without Previous Addresses": {
+			MockError:      errors.New("reason"),
+			ExpectedError:  "error resolving host '" + host + "': reason",
+			ExpectedOutput: nil,
+		},
+		"Empty Resolution Without Previous Addresses": {
+			MockOutput:     []net.IPAddr{},
+			ExpectedError:  "error resolving host '" + host + "': no addresses",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.Resolver)
+		if tc.Previous != nil {
+			m.On("LookupIPAddr", mock.Anything, host).Return(tc.Previous, nil).Once()
+		}
+		m.On("LookupIPAddr", mock.Anything, host).Return(tc.MockOutput, tc.MockError).Once()
+
+		hosts := app.NewHostCache(m, tc.MinTTL)
+		if tc.Previous != nil {
+			if _, err := hosts.Resolve(host); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result, err := hosts.Resolve(host)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestRunWithUnresolvedHost(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Rules          []*app.Rule
+		RuleSets       map[string][]*app.Rule
+		Tags           []*ec2.Tag
+		ExpectedRevoke []string
+	}
+
+	suite := map[string]test{
+		"Rule": {
+			Rules:          []*app.Rule{{Host: host}, {CIDR: aws.String("10.0.0.0/16")}},
+			Tags:           nil,
+			ExpectedRevoke: []string{"172.16.0.0/12"},
+		},
+		"Excluded Rule": {
+			Rules: []*app.Rule{{Name: "partner", Host: host}, {CIDR: aws.String("10.0.0.0/16")}},
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagExclude), Value: aws.String("partner")},
+			},
+			ExpectedRevoke: []string{"198.51.100.1/32", "172.16.0.0/12"},
+		},
+		"Applied Rule Set": {
+			Rules:    []*app.Rule{{CIDR: aws.String("10.0.0.0/16")}},
+			RuleSets: map[string][]*app.Rule{"partners": {{Host: host}}},
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagExtra), Value: aws.String("partners")},
+			},
+			ExpectedRevoke: []string{"172.16.0.0/12"},
+		},
+		"Other Rule Set": {
+			Rules:          []*app.Rule{{CIDR: aws.String("10.0.0.0/16")}},
+			RuleSets:       map[string][]*app.Rule{"partners": {{Host: host}}},
+			Tags:           nil,
+			ExpectedRevoke: []string{"198.51.100.1/32", "172.16.0.0/12"},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		r := new(mocks.Resolver)
+		r.On("LookupIPAddr", mock.Anything, host).Return(nil, errors.New("reason"))
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules:    tc.Rules,
+			RuleSets: tc.RuleSets,
+		}
+
+		assert.NoError(c.Expand(nil, app.NewHostCache(r, time.Hour)))
+
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				{
+					GroupId: aws.String("sg-1"),
+					Tags:    append([]*ec2.Tag{{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)}}, tc.Tags...),
+					IpPermissions: []*ec2.IpPermission{
+						{
+							IpProtocol: aws.String("tcp"),
+							FromPort:   aws.Int64(22),
+							ToPort:     aws.Int64(22),
+							IpRanges: []*ec2.IpRange{
+								{
+									CidrIp:      aws.String("198.51.100.1/32"),
+									Description: aws.String(app.RuleDescription),
+								},
+								// a network cannot come from a host
+								{
+									CidrIp:      aws.String("172.16.0.0/12"),
+									Description: aws.String(app.RuleDescription),
+								},
+							},
+						},
+					},
+				},
+			},
+		}, nil).Once()
+		m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+		var revoked []string
+		m.On("RevokeSecurityGroupIngress", mock.Anything).Run(func(args mock.Arguments) {
+			for _, p := range args.Get(0).(*ec2.RevokeSecurityGroupIngressInput).IpPermissions {
+				revoked = append(revoked, aws.StringValue(p.IpRanges[0].CidrIp))
+			}
+		}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+
+		assert.NoError(c.Run(m))
+
+		m.AssertExpectations(t)
+		assert.Equal(tc.ExpectedRevoke, revoked)
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Invocation is the payload of a manual invocation (e.g. from a runbook),
+// limiting a run to security groups, protocols and regions.
+// DryRun only logs the changes which would be made.
+// IgnoreOverrides applies the rules regardless of the TagPaused,
+// TagExclude and TagExtra tags of security groups.
+// Snapshot captures the managed rules to a location instead of reconciling,
+// and Restore reconciles security groups back to a snapshot at a location.
+// Compliance writes a read-only drift report to a location, in the
+// ComplianceFormat or the format of its extension.
+type Invocation struct {
+	Groups           []string `json:"groups,omitempty"`
+	Protocols        []string `json:"protocols,omitempty"`
+	Regions          []string `json:"regions,omitempty"`
+	DryRun           bool     `json:"dry_run,omitempty"`
+	IgnoreOverrides  bool     `json:"ignore_overrides,omitempty"`
+	Snapshot         string   `json:"snapshot,omitempty"`
+	Restore          string   `json:"restore,omitempty"`
+	MaxRevocations   int      `json:"max_revocations,omitempty"`
+	Compliance       string   `json:"compliance,omitempty"`
+	ComplianceFormat string   `json:"compliance_format,omitempty"`
+}
+
+// ParseInvocation returns the Invocation of a payload, ok is false for
+// an empty payload and for EventBridge events
+func ParseInvocation(data []byte) (inv *Invocation, ok bool, err error) {
+	if len(strings.TrimSpace(string(data))) == 0 || string(data) == "null" {
+		return nil, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing invocation")
+	}
+
+	if _, ok := fields["detail-type"]; ok {
+		return nil, false, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	inv = new(Invocation)
+	if err := decoder.Decode(inv); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing invocation")
+	}
+
+	return inv, true, nil
+}
+
+// Apply an Invocation to a Config (receiver)
+func (c *Config) Apply(inv *Invocation) error {
+	if inv.Snapshot != "" && inv.Restore != "" {
+		return errors.New("invalid invocation, snapshot and restore may not be combined")
+	}
+
+	if inv.MaxRevocations < 0 {
+		return errors.Errorf("invalid max_revocations '%d'", inv.MaxRevocations)
+	}
+
+	if inv.Snapshot != "" && inv.Compliance != "" {
+		return errors.New("invalid invocation, snapshot and compliance may not be combined")
+	}
+
+	if inv.Compliance != "" || inv.ComplianceFormat != "" {
+		if _, err := FormatOf(inv.Compliance, inv.ComplianceFormat); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range inv.Groups {
+		if !strings.HasPrefix(id, "sg-") {
+			return errors.Errorf("invalid security group id '%s'", id)
+		}
+	}
+
+	if len(inv.Protocols) > 0 {
+		protocols := make(map[string]*Protocol, len(inv.Protocols))
+		for _, name := range inv.Protocols {
+			proto, ok := c.Protocols[name]
+			if !ok {
+				return errors.Errorf("unknown protocol '%s'", name)
+			}
+			protocols[name] = proto
+		}
+		c.Protocols = protocols
+	}
+
+	if len(inv.Regions) > 0 {
+		regions := c.Regions
+		c.Regions = inv.Regions
+		if err := c.validateRegions(); err != nil {
+			c.Regions = regions
+			return err
+		}
+	}
+
+	c.groups = inv.Groups
+	c.dryRun = inv.DryRun
+	c.ignoreOverrides = inv.IgnoreOverrides
+	c.capturing = inv.Snapshot != ""
+	c.inspecting = inv.Compliance != ""
+	c.maxRevocations = inv.MaxRevocations
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package app_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func TestParseInvocation(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Payload        string
+		ExpectedOK     bool
+		ExpectedError  string
+		ExpectedOutput *app.Invocation
+	}
+
+	suite := map[string]test{
+		"Invocation": {
+			Payload:       `{"groups": ["sg-1"], "protocols": ["ssh"], "regions": ["us-west-2"], "dry_run": true, "ignore_overrides": true}`,
+			ExpectedOK:    true,
+			ExpectedError: "",
+			ExpectedOutput: &app.Invocation{
+				Groups:          []string{"sg-1"},
+				Protocols:       []string{"ssh"},
+				Regions:         []string{"us-west-2"},
+				DryRun:          true,
+				IgnoreOverrides: true,
+			},
+		},
+		"Empty Payload": {
+			Payload:        "",
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+		"Scheduled Event": {
+			Payload:        `{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`,
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+		"Unknown Field": {
+			Payload:        `{"group": "sg-1"}`,
+			ExpectedOK:     false,
+			ExpectedError:  `error parsing invocation: json: unknown field "group"`,
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		result, ok, err := app.ParseInvocation([]byte(tc.Payload))
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOK, ok)
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestApplyInvocation(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Invocation    *app.Invocation
+		ExpectedError string
+	}
+
+	suite := map[string]test{
+		"Valid": {
+			Invocation:    &app.Invocation{Groups: []string{"sg-1"}, Protocols: []string{"ssh"}, Regions: []string{"us-west-2"}},
+			ExpectedError: "",
+		},
+		"Invalid Group": {
+			Invocation:    &app.Invocation{Groups: []string{"i-1"}},
+			ExpectedError: "invalid security group id 'i-1'",
+		},
+		"Unknown Protocol": {
+			Invocation:    &app.Invocation{Protocols: []string{"rdp"}},
+			ExpectedError: "unknown protocol 'rdp'",
+		},
+		"Invalid Regions": {
+			Invocation:    &app.Invocation{Regions: []string{"all", "us-west-2"}},
+			ExpectedError: "invalid regions, 'all' may not be combined with other regions",
+		},
+		"Snapshot And Restore": {
+			Invocation:    &app.Invocation{Snapshot: "snapshot.json", Restore: "snapshot.json"},
+			ExpectedError: "invalid invocation, snapshot and restore may not be combined",
+		},
+		"Snapshot And Compliance": {
+			Invocation:    &app.Invocation{Snapshot: "snapshot.json", Compliance: "report.md"},
+			ExpectedError: "invalid invocation, snapshot and compliance may not be combined",
+		},
+		"Negative Max Revocations": {
+			Invocation:    &app.Invocation{Restore: "snapshot.json", MaxRevocations: -1},
+			ExpectedError: "invalid max_revocations '-1'",
+		},
+		"Unknown Compliance Format": {
+			Invocation:    &app.Invocation{Compliance: "report", ComplianceFormat: "pdf"},
+			ExpectedError: "unknown compliance format 'pdf'",
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+			},
+		}
+
+		err := c.Apply(tc.Invocation)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+			assert.Equal(tc.Invocation.Regions, c.Regions)
+		}
+	}
+}
+
+func TestRunInvocation(t *testing.T) {
+	assert := assert.New(t)
+
+	owned := func(port int64, cidr string) *ec2.IpPermission {
+		return &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(port),
+			ToPort:     aws.Int64(port),
+			IpRanges: []*ec2.IpRange{
+				{
+					CidrIp:      aws.String(cidr),
+					Description: aws.String(app.RuleDescription),
+				},
+			},
+		}
+	}
+
+	type test struct {
+		Invocation  *app.Invocation
+		ExpectedAdd []*ec2.IpPermission
+	}
+
+	suite := map[string]test{
+		"Paused": {
+			Invocation:  &app.Invocation{Groups: []string{"sg-1"}, Protocols: []string{"ssh"}},
+			ExpectedAdd: nil,
+		},
+		"Ignore Overrides": {
+			Invocation:  &app.Invocation{Groups: []string{"sg-1"}, Protocols: []string{"ssh"}, IgnoreOverrides: true},
+			ExpectedAdd: []*ec2.IpPermission{owned(22, "10.0.0.0/16")},
+		},
+		"Dry Run": {
+			Invocation:  &app.Invocation{Groups: []string{"sg-1"}, Protocols: []string{"ssh"}, IgnoreOverrides: true, DryRun: true},
+			ExpectedAdd: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"http": {Transport: aws.String("tcp"), FromPort: aws.Int64(80), ToPort: aws.Int64(80)},
+				"ssh":  {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+			},
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16")},
+			},
+		}
+
+		assert.NoError(c.Apply(tc.Invocation))
+
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", &ec2.DescribeSecurityGroupsInput{
+			MaxResults: aws.Int64(100),
+			Filters: []*ec2.Filter{
+				{Name: aws.String("tag-key"), Values: []*string{aws.String("ssh")}},
+				{Name: aws.String("group-id"), Values: []*string{aws.String("sg-1")}},
+			},
+		}).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				{
+					GroupId: aws.String("sg-1"),
+					Tags: []*ec2.Tag{
+						{Key: aws.String("http"), Value: aws.String(app.TagProtocolValue)},
+						{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+						{Key: aws.String(app.TagPaused), Value: aws.String("true")},
+					},
+				},
+			},
+		}, nil).Once()
+		if tc.ExpectedAdd != nil {
+			m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+				DryRun:        aws.Bool(false),
+				GroupId:       aws.String("sg-1"),
+				IpPermissions: tc.ExpectedAdd,
+			}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+		}
+
+		assert.NoError(c.Run(m))
+
+		m.AssertExpectations(t)
+		if tc.ExpectedAdd == nil {
+			m.AssertNotCalled(t, "AuthorizeSecurityGroupIngress", mock.Anything)
+		}
+	}
+}
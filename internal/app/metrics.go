@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// MetricsNamespace is the CloudWatch namespace of emitted metrics
+const MetricsNamespace = "SecurityGroupManager"
+
+// Metric names
+const (
+	MetricGroupsScanned = "GroupsScanned"
+	MetricRulesAdded    = "RulesAdded"
+	MetricRulesRevoked  = "RulesRevoked"
+	MetricDuplicates    = "Duplicates"
+	MetricLimitHits     = "LimitHits"
+	MetricGroupErrors   = "GroupErrors"
+)
+
+// AllProtocols is the protocol dimension of metrics not related to a single protocol
+const AllProtocols = "all"
+
+type metricKey struct {
+	account  string
+	region   string
+	protocol string
+}
+
+// count adds to a metric of a protocol in the account and region of a Config (receiver)
+func (c *Config) count(protocol, name string, n int) {
+	j := c.journal()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.metrics == nil {
+		j.metrics = make(map[metricKey]map[string]float64)
+	}
+
+	key := metricKey{account: c.account, region: c.region, protocol: protocol}
+	if j.metrics[key] == nil {
+		j.metrics[key] = make(map[string]float64)
+	}
+	j.metrics[key][name] += float64(n)
+}
+
+// EmitMetrics writes metrics counted by runs of a Config (receiver) as
+// CloudWatch Embedded Metric Format lines, one per account, region and
+// protocol. An empty account or region is replaced by the given defaults.
+func (c *Config) EmitMetrics(w io.Writer, account, region string, at time.Time) error {
+	j := c.journal()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	keys := make([]metricKey, 0, len(j.metrics))
+	for key := range j.metrics {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].account != keys[b].account {
+			return keys[a].account < keys[b].account
+		}
+		if keys[a].region != keys[b].region {
+			return keys[a].region < keys[b].region
+		}
+		return keys[a].protocol < keys[b].protocol
+	})
+
+	encoder := json.NewEncoder(w)
+
+	for _, key := range keys {
+		values := j.metrics[key]
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		definitions := make([]map[string]string, 0, len(names))
+		line := map[string]interface{}{
+			"Account":  defaultString(key.account, account),
+			"Region":   defaultString(key.region, region),
+			"Protocol": key.protocol,
+		}
+		for _, name := range names {
+			definitions = append(definitions, map[string]string{"Name": name, "Unit": "Count"})
+			line[name] = values[name]
+		}
+
+		line["_aws"] = map[string]interface{}{
+			"Timestamp": at.UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{
+				{
+					"Namespace":  MetricsNamespace,
+					"Dimensions": [][]string{{"Account", "Region", "Protocol"}},
+					"Metrics":    definitions,
+				},
+			},
+		}
+
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
@@ -0,0 +1,119 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+func TestEmitMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"http": {Transport: aws.String("tcp"), FromPort: aws.Int64(80), ToPort: aws.Int64(80)},
+			"ssh":  {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+			{CIDR: aws.String("172.16.0.0/12")},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.AuthorizeSecurityGroupIngressInput) bool {
+		return len(input.IpPermissions) == 2
+	})).Return(nil, errors.New("InvalidPermission.Duplicate: the specified rule already exists")).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.AuthorizeSecurityGroupIngressInput) bool {
+		return *input.IpPermissions[0].IpRanges[0].CidrIp == "10.0.0.0/16"
+	})).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.AuthorizeSecurityGroupIngressInput) bool {
+		return *input.IpPermissions[0].IpRanges[0].CidrIp == "172.16.0.0/12"
+	})).Return(nil, errors.New("InvalidPermission.Duplicate: the specified rule already exists")).Once()
+
+	assert.NoError(c.Run(m))
+
+	var out bytes.Buffer
+	assert.NoError(c.EmitMetrics(&out, "default", "us-east-1", time.UnixMilli(1760000000000)))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal([]string{
+		`{"Account":"default","GroupsScanned":0,"Protocol":"http","Region":"us-east-1","_aws":{"CloudWatchMetrics":[{"Dimensions":[["Account","Region","Protocol"]],"Metrics":[{"Name":"GroupsScanned","Unit":"Count"}],"Namespace":"SecurityGroupManager"}],"Timestamp":1760000000000}}`,
+		`{"Account":"default","Duplicates":1,"GroupsScanned":1,"Protocol":"ssh","Region":"us-east-1","RulesAdded":1,"_aws":{"CloudWatchMetrics":[{"Dimensions":[["Account","Region","Protocol"]],"Metrics":[{"Name":"Duplicates","Unit":"Count"},{"Name":"GroupsScanned","Unit":"Count"},{"Name":"RulesAdded","Unit":"Count"}],"Namespace":"SecurityGroupManager"}],"Timestamp":1760000000000}}`,
+	}, lines)
+
+	m.AssertExpectations(t)
+}
+
+func TestEmitMetricsPerRegion(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules:   []*app.Rule{},
+		Regions: []string{"eu-west-1", "us-west-2"},
+	}
+
+	_, err := c.RunRegions(nil, func(region string) sg.Client {
+		m := new(mocks.SG)
+		if region == "eu-west-1" {
+			m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{}, nil).Once()
+		} else {
+			m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []*ec2.SecurityGroup{
+					{
+						GroupId: aws.String("sg-1"),
+						Tags: []*ec2.Tag{
+							{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+						},
+						IpPermissions: []*ec2.IpPermission{
+							{
+								IpProtocol: aws.String("tcp"),
+								FromPort:   aws.Int64(22),
+								ToPort:     aws.Int64(22),
+								IpRanges: []*ec2.IpRange{
+									{CidrIp: aws.String("10.0.0.0/16"), Description: aws.String(app.RuleDescription)},
+								},
+							},
+						},
+					},
+				},
+			}, nil).Once()
+			m.On("RevokeSecurityGroupIngress", mock.Anything).Return(nil, errors.New("reason")).Once()
+		}
+		return m
+	})
+	assert.EqualError(err, "error reconciling regions [us-west-2]")
+
+	var out bytes.Buffer
+	assert.NoError(c.EmitMetrics(&out, "default", "us-east-1", time.UnixMilli(0)))
+
+	output := out.String()
+	assert.Equal(3, strings.Count(output, "\n"))
+	assert.Contains(output, `"Protocol":"ssh","Region":"eu-west-1"`)
+	assert.Contains(output, `{"Account":"default","GroupErrors":1,"Protocol":"all","Region":"us-west-2"`)
+	assert.Contains(output, `{"Account":"default","GroupsScanned":1,"Protocol":"ssh","Region":"us-west-2"`)
+}
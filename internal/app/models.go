@@ -1,36 +1,152 @@
 package app
 
-import "github.com/aws/aws-sdk-go/service/secretsmanager"
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
 
 // TagProtocolValue should match this value in order to indicate that
 // a certain protocol should be managed on tagged security group.
 // In any case, only "owned" rules will be managed.
+// May be overridden with Config.TagValue.
 const TagProtocolValue = "managed"
 
+// TagKeyTemplate is the default tag key of a protocol, where
+// "{protocol}" is replaced with the protocol name.
+// May be overridden with Config.TagKey.
+const TagKeyTemplate = "{protocol}"
+
 // RuleDescription should match this value in order to indicate that
 // a certain rule should be managed on security group.
+// May be overridden with Config.RuleDescription.
 const RuleDescription = "owned"
 
+// TagPrefix is the default prefix of override tags.
+// May be overridden with Config.TagPrefix.
+const TagPrefix = "sgm:"
+
+// TagPaused set to "true" on a security group pauses its management
+const TagPaused = TagPrefix + "paused"
+
+// TagExclude on a security group lists rule names or CIDRs
+// (separated by commas or spaces) which should not be applied to it
+const TagExclude = TagPrefix + "exclude"
+
+// TagExtra on a security group lists rule sets (separated by
+// commas or spaces) which should be applied to it in addition to the rules
+const TagExtra = TagPrefix + "extra"
+
 // Config defines a configuration
 // Protocol name should be an AWS Support Application Protocol
+// ExpiryWarning is a duration (e.g. "72h") within which expiring rules are reported
+// RuleSets are applied only to security groups opting in with the TagExtra tag
+// TagKey, TagValue, TagPrefix and RuleDescription allow independent deployments
+// to manage disjoint rules on the same security groups
+// Scope limits managed security groups by VPC, name and owner account
+// Regions are reconciled concurrently from a single invocation, "all" meaning every enabled region
+// Accounts are reconciled concurrently through assumed roles, Discovery adds accounts of AWS Organizations
+// Concurrency limits the regions, and the accounts, reconciled at the same time
+// Notifications publish a summary of the changes of every run
 type Config struct {
-	Protocols map[string]*Protocol `json:"protocols"`
-	Rules     []*Rule              `json:"rules"`
+	Protocols       map[string]*Protocol `json:"protocols" yaml:"protocols"`
+	Rules           []*Rule              `json:"rules" yaml:"rules"`
+	RuleSets        map[string][]*Rule   `json:"rule_sets,omitempty" yaml:"rule_sets,omitempty"`
+	ExpiryWarning   string               `json:"expiry_warning,omitempty" yaml:"expiry_warning,omitempty"`
+	TagKey          string               `json:"tag_key,omitempty" yaml:"tag_key,omitempty"`
+	TagValue        string               `json:"tag_value,omitempty" yaml:"tag_value,omitempty"`
+	TagPrefix       string               `json:"tag_prefix,omitempty" yaml:"tag_prefix,omitempty"`
+	RuleDescription string               `json:"rule_description,omitempty" yaml:"rule_description,omitempty"`
+	Scope           *Scope               `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Regions         []string             `json:"regions,omitempty" yaml:"regions,omitempty"`
+	Accounts        []*Account           `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Concurrency     int                  `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Discovery       *Discovery           `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+	Notifications   *Notifications       `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+
+	// unresolved are rules which could not be resolved, by rule set ("" for
+	// Rules), so a failed lookup never revokes existing entries of the
+	// security groups they apply to
+	unresolved map[string][]*Rule
+	// clock returns the current time, time.Now when nil
+	clock func() time.Time
+	// skipped are tagged security groups out of the Scope
+	skipped []*SkippedGroup
+	// groups limits a Run to security groups with these IDs
+	groups []string
+	// dryRun only logs changes instead of making them
+	dryRun bool
+	// ignoreOverrides disregards override tags of security groups
+	ignoreOverrides bool
+	// capturing records managed rules instead of reconciling them
+	capturing bool
+	// inspecting reports drift instead of reconciling security groups
+	inspecting bool
+	// restore holds the snapshots of security groups to reconcile back to
+	restore map[string]*GroupSnapshot
+	// maxRevocations limits the rules revoked by a restore, DefaultMaxRevocations when 0
+	maxRevocations int
+	// account (ID) and region label modifications of a copy reconciling
+	// them, accountName is the configured name of the account
+	account     string
+	accountName string
+	region      string
+	// changes is shared with copies reconciling other regions and accounts
+	changes *journal
+	// ctx is the parent context of spans
+	ctx context.Context
 }
 
 // Protocol represents a single protocol configuration
 type Protocol struct {
-	Transport *string `json:"transport"`
-	FromPort  *int64  `json:"from_port"`
-	ToPort    *int64  `json:"to_port"`
+	Transport *string `json:"transport" yaml:"transport"`
+	FromPort  *int64  `json:"from_port" yaml:"from_port"`
+	ToPort    *int64  `json:"to_port" yaml:"to_port"`
 }
 
-// Rule represents a whitelisted CIDR
+// Rule represents a whitelisted CIDR, a Feed of CIDRs or a Host name,
+// the latter two are expanded before reconciliation.
+// Name allows a security group to opt out of a rule with the TagExclude tag.
+// Note describes a rule in change notifications.
+// A rule is absent before NotBefore, after ExpiresAt and outside of its Schedule.
+// In an overlay source, Remove drops a rule defined by a previous source.
 type Rule struct {
-	CIDR *string `json:"cidr"`
+	Name      string     `json:"name,omitempty" yaml:"name,omitempty"`
+	CIDR      *string    `json:"cidr" yaml:"cidr"`
+	Note      string     `json:"note,omitempty" yaml:"note,omitempty"`
+	Feed      *Feed      `json:"feed,omitempty" yaml:"feed,omitempty"`
+	Host      string     `json:"host,omitempty" yaml:"host,omitempty"`
+	NotBefore *time.Time `json:"not_before,omitempty" yaml:"not_before,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Schedule  *Schedule  `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Remove    bool       `json:"remove,omitempty" yaml:"remove,omitempty"`
 }
 
 // Client represents a Secrets Manager client
 type Client interface {
 	GetSecretValue(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
 }
+
+// SSMClient represents a Systems Manager Parameter Store client
+type SSMClient interface {
+	GetParameter(*ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+}
+
+// S3Client represents an S3 client
+type S3Client interface {
+	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// S3Writer represents an S3 client writing objects
+type S3Writer interface {
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+// DynamoDBClient represents a DynamoDB client
+type DynamoDBClient interface {
+	BatchWriteItem(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+}
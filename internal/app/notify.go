@@ -0,0 +1,246 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/pkg/errors"
+)
+
+// ActionAdded and ActionRemoved are the actions of a Modification
+const (
+	ActionAdded   = "added"
+	ActionRemoved = "removed"
+)
+
+// DefaultNotificationBatch is the default number of changes per notification message
+const DefaultNotificationBatch = 50
+
+// Notifications publishes a summary of the changes of every run to an SNS
+// Topic and/or a Slack or Teams compatible incoming Webhook.
+// BatchSize limits the changes per message, Unchanged also notifies runs without changes.
+type Notifications struct {
+	Topic     string `json:"sns_topic,omitempty" yaml:"sns_topic,omitempty"`
+	Webhook   string `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	BatchSize int    `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`
+	Unchanged bool   `json:"unchanged,omitempty" yaml:"unchanged,omitempty"`
+}
+
+// Modification is a change made to a security group
+type Modification struct {
+	Time        time.Time `json:"time"`
+	Account     string    `json:"account,omitempty"`
+	AccountName string    `json:"account_name,omitempty"`
+	Region      string    `json:"region,omitempty"`
+	Group       string    `json:"group"`
+	Protocol    string    `json:"protocol"`
+	CIDR        string    `json:"cidr"`
+	Note        string    `json:"note,omitempty"`
+	Action      string    `json:"action"`
+}
+
+// SNSClient represents an SNS client
+type SNSClient interface {
+	Publish(*sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// journal collects modifications and metrics of a Config and of its
+// copies reconciling other regions and accounts
+type journal struct {
+	mu            sync.Mutex
+	modifications []*Modification
+	snapshots     []*GroupSnapshot
+	compliance    []*GroupCompliance
+	revocations   int
+	slots         chan struct{}
+	metrics       map[metricKey]map[string]float64
+}
+
+// Changes returns modifications made by runs of a Config (receiver)
+func (c *Config) Changes() []*Modification {
+	j := c.journal()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]*Modification{}, j.modifications...)
+}
+
+func (c *Config) journal() *journal {
+	if c.changes == nil {
+		c.changes = new(journal)
+	}
+
+	return c.changes
+}
+
+// record changes of a security group
+func (c *Config) record(group *ec2.SecurityGroup, action string, changes ...*change) {
+	j := c.journal()
+	now := c.now()
+
+	j.mu.Lock()
+
+	for _, ch := range changes {
+		j.modifications = append(j.modifications, &Modification{
+			Time:        now,
+			Account:     c.account,
+			AccountName: c.accountName,
+			Region:      c.region,
+			Group:       aws.StringValue(group.GroupId),
+			Protocol:    ch.protocol,
+			CIDR:        cidrOf(ch.rule.Permissions[0]),
+			Note:        ch.note,
+			Action:      action,
+		})
+	}
+	j.mu.Unlock()
+
+	for _, ch := range changes {
+		if action == ActionAdded {
+			c.count(ch.protocol, MetricRulesAdded, 1)
+		} else {
+			c.count(ch.protocol, MetricRulesRevoked, 1)
+		}
+	}
+}
+
+// Notify publishes modifications according to the Notifications of a Config (receiver),
+// nothing is published by dry runs, snapshots and compliance reports which change nothing
+func (c *Config) Notify(topics SNSClient, hooks HTTPClient, modifications []*Modification) error {
+	n := c.Notifications
+	if n == nil || c.dryRun || c.capturing || c.inspecting || (!n.Unchanged && len(modifications) == 0) {
+		return nil
+	}
+
+	for i, message := range n.messages(modifications) {
+		subject := fmt.Sprintf("security-group-manager: %v changes", len(modifications))
+		switch len(modifications) {
+		case 0:
+			subject = "security-group-manager: no changes"
+		case 1:
+			subject = "security-group-manager: 1 change"
+		}
+
+		if n.Topic != "" {
+			_, err := topics.Publish(&sns.PublishInput{
+				TopicArn: aws.String(n.Topic),
+				Subject:  aws.String(subject),
+				Message:  aws.String(message),
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error publishing notification %v to sns", i+1)
+			}
+		}
+
+		if n.Webhook != "" {
+			if err := post(hooks, n.Webhook, subject+"\n"+message); err != nil {
+				return errors.Wrapf(err, "error posting notification %v to webhook", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate Notifications (receiver)
+func (n *Notifications) validate() error {
+	if n == nil {
+		return nil
+	}
+
+	if n.Topic != "" {
+		if _, err := arn.Parse(n.Topic); err != nil {
+			return errors.Errorf("invalid notifications sns_topic '%s'", n.Topic)
+		}
+	}
+
+	if n.Webhook != "" {
+		u, err := url.Parse(n.Webhook)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("invalid notifications webhook, expected an http(s) url")
+		}
+	}
+
+	return nil
+}
+
+// messages returns batches of modifications formatted as text
+func (n *Notifications) messages(modifications []*Modification) []string {
+	if len(modifications) == 0 {
+		return []string{"no security groups were changed"}
+	}
+
+	size := n.BatchSize
+	if size <= 0 {
+		size = DefaultNotificationBatch
+	}
+
+	messages := make([]string, 0, (len(modifications)+size-1)/size)
+	for start := 0; start < len(modifications); start += size {
+		end := min(start+size, len(modifications))
+
+		lines := make([]string, 0, end-start+1)
+		if len(modifications) > size {
+			lines = append(lines, fmt.Sprintf("changes %v-%v of %v:", start+1, end, len(modifications)))
+		}
+
+		for _, m := range modifications[start:end] {
+			lines = append(lines, m.String())
+		}
+
+		messages = append(messages, strings.Join(lines, "\n"))
+	}
+
+	return messages
+}
+
+// String describes a Modification (receiver) in a single line
+func (m *Modification) String() string {
+	s := fmt.Sprintf("%s %s on %s of %s", m.Action, m.CIDR, m.Protocol, m.Group)
+
+	if location := strings.Trim(m.Account+"/"+m.Region, "/"); location != "" {
+		s += " in " + location
+	}
+
+	if m.Note != "" {
+		s += " (" + m.Note + ")"
+	}
+
+	return s
+}
+
+func post(cli HTTPClient, target, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("unexpected status '%s'", resp.Status)
+	}
+
+	return nil
+}
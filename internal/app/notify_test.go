@@ -0,0 +1,211 @@
+package app_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+const topic string = "arn:aws:sns:us-east-1:111111111111:security"
+
+func TestNotify(t *testing.T) {
+	assert := assert.New(t)
+
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body["text"])
+	}))
+	defer server.Close()
+
+	modifications := []*app.Modification{
+		{Group: "sg-1", Protocol: "ssh", CIDR: "10.0.0.0/16", Note: "New Jersey Office", Action: app.ActionAdded},
+		{Account: "111111111111", Region: "us-west-2", Group: "sg-2", Protocol: "https", CIDR: "192.168.0.0/16", Action: app.ActionRemoved},
+		{Group: "sg-1", Protocol: "ssh", CIDR: "172.16.0.0/12", Action: app.ActionAdded},
+	}
+
+	type test struct {
+		Notifications    *app.Notifications
+		Invocation       *app.Invocation
+		Modifications    []*app.Modification
+		Subject          string
+		PublishError     error
+		ExpectedError    string
+		ExpectedMessages []string
+	}
+
+	suite := map[string]test{
+		"Batches": {
+			Notifications: &app.Notifications{Topic: topic, Webhook: server.URL, BatchSize: 2},
+			Modifications: modifications,
+			Subject:       "security-group-manager: 3 changes",
+			ExpectedError: "",
+			ExpectedMessages: []string{
+				"changes 1-2 of 3:\nadded 10.0.0.0/16 on ssh of sg-1 (New Jersey Office)\nremoved 192.168.0.0/16 on https of sg-2 in 111111111111/us-west-2",
+				"changes 3-3 of 3:\nadded 172.16.0.0/12 on ssh of sg-1",
+			},
+		},
+		"No Changes": {
+			Notifications:    &app.Notifications{Topic: topic, Webhook: server.URL, Unchanged: true},
+			Modifications:    nil,
+			Subject:          "security-group-manager: no changes",
+			ExpectedError:    "",
+			ExpectedMessages: []string{"no security groups were changed"},
+		},
+		"No Changes By Default": {
+			Notifications:    &app.Notifications{Topic: topic, Webhook: server.URL},
+			Modifications:    nil,
+			Subject:          "security-group-manager: no changes",
+			ExpectedError:    "",
+			ExpectedMessages: nil,
+		},
+		"Dry Run": {
+			Notifications:    &app.Notifications{Topic: topic, Webhook: server.URL, Unchanged: true},
+			Invocation:       &app.Invocation{DryRun: true},
+			Modifications:    nil,
+			Subject:          "security-group-manager: no changes",
+			ExpectedError:    "",
+			ExpectedMessages: nil,
+		},
+		"Snapshot": {
+			Notifications:    &app.Notifications{Topic: topic, Webhook: server.URL, Unchanged: true},
+			Invocation:       &app.Invocation{Snapshot: "s3://snapshots/sgm.json"},
+			Modifications:    nil,
+			Subject:          "security-group-manager: no changes",
+			ExpectedError:    "",
+			ExpectedMessages: nil,
+		},
+		"Compliance": {
+			Notifications:    &app.Notifications{Topic: topic, Webhook: server.URL, Unchanged: true},
+			Invocation:       &app.Invocation{Compliance: "s3://reports/sgm.json"},
+			Modifications:    nil,
+			Subject:          "security-group-manager: no changes",
+			ExpectedError:    "",
+			ExpectedMessages: nil,
+		},
+		"Disabled": {
+			Notifications:    nil,
+			Modifications:    modifications,
+			Subject:          "security-group-manager: 3 changes",
+			ExpectedError:    "",
+			ExpectedMessages: nil,
+		},
+		"SNS Failure": {
+			Notifications:    &app.Notifications{Topic: topic},
+			Modifications:    modifications[:1],
+			PublishError:     errors.New("reason"),
+			Subject:          "security-group-manager: 1 change",
+			ExpectedError:    "error publishing notification 1 to sns: reason",
+			ExpectedMessages: []string{"added 10.0.0.0/16 on ssh of sg-1 (New Jersey Office)"},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		posted = nil
+
+		m := new(mocks.SNS)
+		for _, message := range tc.ExpectedMessages {
+			m.On("Publish", &sns.PublishInput{
+				TopicArn: aws.String(topic),
+				Subject:  aws.String(tc.Subject),
+				Message:  aws.String(message),
+			}).Return(&sns.PublishOutput{}, tc.PublishError).Once()
+		}
+
+		c := &app.Config{Notifications: tc.Notifications}
+		if tc.Invocation != nil {
+			assert.NoError(c.Apply(tc.Invocation))
+		}
+		err := c.Notify(m, http.DefaultClient, tc.Modifications)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+
+			var expected []string
+			if tc.Notifications != nil && tc.Notifications.Webhook != "" {
+				for _, message := range tc.ExpectedMessages {
+					expected = append(expected, tc.Subject+"\n"+message)
+				}
+			}
+			assert.Equal(expected, posted)
+		}
+
+		m.AssertExpectations(t)
+	}
+}
+
+func TestRunRecordsChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16"), Note: "New Jersey Office"},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+				},
+				IpPermissions: []*ec2.IpPermission{
+					{
+						IpProtocol: aws.String("tcp"),
+						FromPort:   aws.Int64(22),
+						ToPort:     aws.Int64(22),
+						IpRanges: []*ec2.IpRange{
+							{CidrIp: aws.String("192.168.0.0/16"), Description: aws.String(app.RuleDescription)},
+						},
+					},
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("RevokeSecurityGroupIngress", mock.Anything).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	app.SetClock(c, func() time.Time { return now })
+
+	assert.NoError(c.Run(m))
+	assert.Equal([]*app.Modification{
+		{Time: now, Group: "sg-1", Protocol: "ssh", CIDR: "192.168.0.0/16", Action: app.ActionRemoved},
+		{Time: now, Group: "sg-1", Protocol: "ssh", CIDR: "10.0.0.0/16", Note: "New Jersey Office", Action: app.ActionAdded},
+	}, c.Changes())
+
+	m.AssertExpectations(t)
+}
+
+func TestLoadInvalidNotifications(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"notifications":{"webhook":"hooks.slack.com/services/x"},"protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid notifications webhook, expected an http(s) url")
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+// AllRegions in Config.Regions reconciles every region enabled in the account
+const AllRegions = "all"
+
+// DefaultConcurrency is the default number of regions, of all accounts,
+// which are reconciled at the same time
+const DefaultConcurrency = 4
+
+// RegionClient represents an EC2 client listing regions
+type RegionClient interface {
+	DescribeRegions(*ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error)
+}
+
+// RegionReport describes the reconciliation of a single region
+type RegionReport struct {
+	Region  string          `json:"region"`
+	Skipped []*SkippedGroup `json:"skipped,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// RunRegions reconciles the regions of a Config (receiver) concurrently, up to
+// Concurrency at a time, each with its own client. A failed region does not
+// stop the others.
+func (c *Config) RunRegions(cli RegionClient, clients func(region string) sg.Client) ([]*RegionReport, error) {
+	var regions []string
+	err := c.reconcile(func() (err error) {
+		regions, err = c.regions(cli)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*RegionReport, len(regions))
+
+	parallel(len(regions), func(i int) {
+		region := regions[i]
+
+		// every region keeps its own run state
+		rc := *c
+		rc.skipped = nil
+		rc.region = region
+
+		ctx, span := rc.start("region")
+		rc.ctx = ctx
+
+		reports[i] = &RegionReport{
+			Region: region,
+		}
+
+		err := rc.reconcile(func() error {
+			return rc.Run(clients(region))
+		})
+		if err != nil {
+			logger.WithContext(ctx).WithError(err).WithField("region", region).Error("region run failed")
+			reports[i].Error = err.Error()
+		}
+		end(span, err)
+
+		reports[i].Skipped = rc.skipped
+	})
+
+	failed := make([]string, 0)
+	for _, r := range reports {
+		if r.Error != "" {
+			failed = append(failed, r.Region)
+		}
+	}
+
+	if len(failed) > 0 {
+		return reports, errors.Errorf("error reconciling regions %v", failed)
+	}
+
+	return reports, nil
+}
+
+// regions returns sorted regions of a Config (receiver),
+// resolving AllRegions into the regions enabled in the account
+func (c *Config) regions(cli RegionClient) ([]string, error) {
+	if len(c.Regions) != 1 || c.Regions[0] != AllRegions {
+		return c.Regions, nil
+	}
+
+	_, span := c.start("ec2.DescribeRegions")
+	o, err := cli.DescribeRegions(&ec2.DescribeRegionsInput{})
+	end(span, err)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing enabled regions")
+	}
+
+	regions := make([]string, 0, len(o.Regions))
+	for _, r := range o.Regions {
+		regions = append(regions, aws.StringValue(r.RegionName))
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// parallel calls fn for indexes up to n concurrently and waits for all of them
+func parallel(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// reconcile calls fn once a slot is free, so at most Concurrency calls of a
+// Config (receiver) and of its copies, across accounts and regions, run at the same time
+func (c *Config) reconcile(fn func() error) error {
+	slots := c.slots()
+
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	return fn()
+}
+
+// slots returns the semaphore shared by a Config (receiver) and its copies
+func (c *Config) slots() chan struct{} {
+	j := c.journal()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.slots == nil {
+		limit := c.Concurrency
+		if limit <= 0 {
+			limit = DefaultConcurrency
+		}
+		j.slots = make(chan struct{}, limit)
+	}
+
+	return j.slots
+}
+
+// validateRegions of a Config (receiver)
+func (c *Config) validateRegions() error {
+	if c.Concurrency < 0 {
+		return errors.Errorf("invalid concurrency '%d'", c.Concurrency)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, region := range c.Regions {
+		if region == AllRegions && len(c.Regions) > 1 {
+			return errors.Errorf("invalid regions, '%s' may not be combined with other regions", AllRegions)
+		}
+
+		if region == "" || seen[region] {
+			return errors.Errorf("invalid region '%s'", region)
+		}
+		seen[region] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+func TestRunRegions(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Regions         []string
+		Enabled         []string
+		EnabledError    error
+		Failing         map[string]bool
+		ExpectedError   string
+		ExpectedReports []*app.RegionReport
+	}
+
+	suite := map[string]test{
+		"Listed Regions": {
+			Regions:       []string{"us-west-2", "eu-west-1"},
+			ExpectedError: "",
+			ExpectedReports: []*app.RegionReport{
+				{Region: "us-west-2", Skipped: []*app.SkippedGroup{}},
+				{Region: "eu-west-1", Skipped: []*app.SkippedGroup{}},
+			},
+		},
+		"All Enabled Regions": {
+			Regions:       []string{app.AllRegions},
+			Enabled:       []string{"us-west-2", "eu-west-1"},
+			ExpectedError: "",
+			ExpectedReports: []*app.RegionReport{
+				{Region: "eu-west-1", Skipped: []*app.SkippedGroup{}},
+				{Region: "us-west-2", Skipped: []*app.SkippedGroup{}},
+			},
+		},
+		"Failed Region": {
+			Regions:       []string{"us-east-1", "us-west-2"},
+			Failing:       map[string]bool{"us-east-1": true},
+			ExpectedError: "error reconciling regions [us-east-1]",
+			ExpectedReports: []*app.RegionReport{
+				{Region: "us-east-1", Skipped: []*app.SkippedGroup{}, Error: "reason"},
+				{Region: "us-west-2", Skipped: []*app.SkippedGroup{}},
+			},
+		},
+		"Listing Failure": {
+			Regions:         []string{app.AllRegions},
+			EnabledError:    errors.New("reason"),
+			ExpectedError:   "error listing enabled regions: reason",
+			ExpectedReports: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules:   []*app.Rule{},
+			Regions: tc.Regions,
+		}
+
+		r := new(mocks.Regions)
+		if tc.Enabled != nil || tc.EnabledError != nil {
+			regions := make([]*ec2.Region, 0)
+			for _, name := range tc.Enabled {
+				regions = append(regions, &ec2.Region{RegionName: aws.String(name)})
+			}
+			r.On("DescribeRegions", &ec2.DescribeRegionsInput{}).Return(&ec2.DescribeRegionsOutput{Regions: regions}, tc.EnabledError).Once()
+		}
+
+		clients := make(map[string]*mocks.SG)
+		for _, region := range append(tc.Regions, tc.Enabled...) {
+			if region == app.AllRegions {
+				continue
+			}
+
+			m := new(mocks.SG)
+			if tc.Failing[region] {
+				m.On("DescribeSecurityGroups", mock.Anything).Return(nil, errors.New("reason")).Once()
+			} else {
+				m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{}, nil).Once()
+			}
+			clients[region] = m
+		}
+
+		reports, err := c.RunRegions(r, func(region string) sg.Client {
+			return clients[region]
+		})
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedReports, reports)
+
+		r.AssertExpectations(t)
+		if tc.EnabledError == nil {
+			for _, m := range clients {
+				m.AssertExpectations(t)
+			}
+		}
+	}
+}
+
+func TestLoadInvalidRegions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"regions":["all","us-east-1"],"protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid regions, 'all' may not be combined with other regions")
+}
+
+func TestRunRegionsConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	regions := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		regions = append(regions, fmt.Sprintf("region-%d", i))
+	}
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules:       []*app.Rule{},
+		Regions:     regions,
+		Concurrency: 3,
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	reports, err := c.RunRegions(new(mocks.Regions), func(region string) sg.Client {
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", mock.Anything).Run(func(mock.Arguments) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}).Return(&ec2.DescribeSecurityGroupsOutput{}, nil).Once()
+		return m
+	})
+
+	assert.NoError(err)
+	assert.Len(reports, 10)
+	assert.Equal(3, peak)
+}
+
+func TestLoadInvalidConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"concurrency":-1,"protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid concurrency '-1'")
+}
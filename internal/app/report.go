@@ -0,0 +1,42 @@
+package app
+
+// Report summarizes a single invocation
+type Report struct {
+	Change     *Change          `json:"change,omitempty"`
+	Invocation *Invocation      `json:"invocation,omitempty"`
+	Sources    []*SourceReport  `json:"sources"`
+	Expiring   []*ExpiringRule  `json:"expiring,omitempty"`
+	Scheduled  []*ScheduledRule `json:"scheduled,omitempty"`
+	Skipped    []*SkippedGroup  `json:"skipped,omitempty"`
+	Regions    []*RegionReport  `json:"regions,omitempty"`
+	Accounts   []*AccountReport `json:"accounts,omitempty"`
+	Changes    []*Modification  `json:"changes,omitempty"`
+}
+
+// SourceReport describes a configuration source as it was applied
+type SourceReport struct {
+	Source   string `json:"source"`
+	Version  string `json:"version,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+}
+
+// NewReport returns a Report describing the versions of loaded sources
+func NewReport(srcs ...Source) *Report {
+	r := &Report{
+		Sources: make([]*SourceReport, 0, len(srcs)),
+	}
+
+	for _, src := range srcs {
+		s := &SourceReport{
+			Source: src.String(),
+		}
+
+		if v, ok := src.(Versioned); ok {
+			s.Version, s.Fallback = v.Version()
+		}
+
+		r.Sources = append(r.Sources, s)
+	}
+
+	return r
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule opens a rule during a recurring weekly window, e.g. Saturdays
+// from "02:00" to "06:00" in "UTC". An End before Start spans midnight,
+// and no Days means every day.
+type Schedule struct {
+	Days     []string `json:"days,omitempty" yaml:"days,omitempty"`
+	Start    string   `json:"start" yaml:"start"`
+	End      string   `json:"end" yaml:"end"`
+	Timezone string   `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// ScheduledRule describes the state of a scheduled rule
+type ScheduledRule struct {
+	Rule      string    `json:"rule"`
+	Open      bool      `json:"open"`
+	NextOpen  time.Time `json:"next_open"`
+	NextClose time.Time `json:"next_close"`
+}
+
+type window struct {
+	days     map[time.Weekday]bool
+	start    time.Duration
+	length   time.Duration
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Scheduled returns the state of every scheduled rule of a Config (receiver)
+func (c *Config) Scheduled() []*ScheduledRule {
+	now := c.now()
+	scheduled := make([]*ScheduledRule, 0)
+
+	for _, rule := range c.allRules() {
+		if rule.Schedule == nil {
+			continue
+		}
+
+		w, err := rule.Schedule.parse()
+		if err != nil {
+			continue
+		}
+
+		open, nextOpen, nextClose := w.next(now)
+		scheduled = append(scheduled, &ScheduledRule{
+			Rule:      rule.key(),
+			Open:      open,
+			NextOpen:  nextOpen,
+			NextClose: nextClose,
+		})
+	}
+
+	return scheduled
+}
+
+// open reports whether a Schedule (receiver) is open at a given time,
+// an invalid schedule is never open
+func (s *Schedule) open(now time.Time) bool {
+	w, err := s.parse()
+	if err != nil {
+		return false
+	}
+
+	open, _, _ := w.next(now)
+
+	return open
+}
+
+func (s *Schedule) parse() (*window, error) {
+	w := &window{
+		days:     make(map[time.Weekday]bool),
+		location: time.UTC,
+	}
+
+	for _, day := range s.Days {
+		d, ok := weekdays[strings.ToLower(day[:min(3, len(day))])]
+		if !ok {
+			return nil, errors.Errorf("invalid schedule day '%s'", day)
+		}
+		w.days[d] = true
+	}
+
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseClock(s.End)
+	if err != nil {
+		return nil, err
+	}
+
+	w.start = start
+	w.length = end - start
+	if w.length <= 0 {
+		w.length += 24 * time.Hour
+	}
+
+	if s.Timezone != "" {
+		if w.location, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, errors.Errorf("invalid schedule timezone '%s'", s.Timezone)
+		}
+	}
+
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid schedule time '%s', expected 'HH:MM'", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// next reports whether a window (receiver) is open at a given time,
+// when it opens next and when it closes next
+func (w *window) next(now time.Time) (open bool, nextOpen, nextClose time.Time) {
+	local := now.In(w.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, w.location)
+
+	for offset := -1; offset <= 8; offset++ {
+		day := midnight.AddDate(0, 0, offset)
+		if len(w.days) > 0 && !w.days[day.Weekday()] {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), int(w.start/time.Hour), int(w.start%time.Hour/time.Minute), 0, 0, w.location)
+		end := start.Add(w.length)
+
+		switch {
+		case !now.Before(start) && now.Before(end):
+			open = true
+			nextClose = end
+		case start.After(now) && nextOpen.IsZero():
+			nextOpen = start
+			if !open {
+				nextClose = end
+			}
+		}
+	}
+
+	return open, nextOpen, nextClose
+}
@@ -0,0 +1,136 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+)
+
+func TestScheduledRules(t *testing.T) {
+	assert := assert.New(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto := &app.Protocol{
+		Transport: aws.String("tcp"),
+		FromPort:  aws.Int64(22),
+		ToPort:    aws.Int64(22),
+	}
+
+	maintenance := &app.Schedule{
+		Days:  []string{"Saturday"},
+		Start: "02:00",
+		End:   "06:00",
+	}
+
+	type test struct {
+		Now             time.Time
+		Schedule        *app.Schedule
+		ExpectedMissing []string
+		ExpectedState   *app.ScheduledRule
+	}
+
+	suite := map[string]test{
+		"Open Window": {
+			Now:             time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC),
+			Schedule:        maintenance,
+			ExpectedMissing: []string{"10.0.0.0/16"},
+			ExpectedState: &app.ScheduledRule{
+				Rule:      "10.0.0.0/16",
+				Open:      true,
+				NextOpen:  time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+				NextClose: time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		"Closed Window": {
+			Now:             time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			Schedule:        maintenance,
+			ExpectedMissing: []string{},
+			ExpectedState: &app.ScheduledRule{
+				Rule:      "10.0.0.0/16",
+				Open:      false,
+				NextOpen:  time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+				NextClose: time.Date(2026, 10, 24, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		"Window Closes At End": {
+			Now:             time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC),
+			Schedule:        maintenance,
+			ExpectedMissing: []string{},
+			ExpectedState: &app.ScheduledRule{
+				Rule:      "10.0.0.0/16",
+				Open:      false,
+				NextOpen:  time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+				NextClose: time.Date(2026, 10, 24, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		"Overnight Window In Timezone": {
+			Now: time.Date(2026, 10, 19, 23, 30, 0, 0, time.UTC),
+			Schedule: &app.Schedule{
+				Start:    "22:00",
+				End:      "02:00",
+				Timezone: "Europe/Berlin",
+			},
+			ExpectedMissing: []string{"10.0.0.0/16"},
+			ExpectedState: &app.ScheduledRule{
+				Rule:      "10.0.0.0/16",
+				Open:      true,
+				NextOpen:  time.Date(2026, 10, 20, 22, 0, 0, 0, berlin),
+				NextClose: time.Date(2026, 10, 20, 2, 0, 0, 0, berlin),
+			},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{"ssh": proto},
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), Schedule: tc.Schedule},
+			},
+		}
+		app.SetClock(c, func() time.Time { return tc.Now })
+
+		result := app.CategorizeRules(c, proto, []*ec2.IpPermission{})
+		state := c.Scheduled()
+
+		assert.Equal(tc.ExpectedMissing, result.Missing.CIDRs)
+		assert.Len(state, 1)
+		assert.Equal(tc.ExpectedState.Rule, state[0].Rule)
+		assert.Equal(tc.ExpectedState.Open, state[0].Open)
+		assert.True(tc.ExpectedState.NextOpen.Equal(state[0].NextOpen), "next open: %s", state[0].NextOpen)
+		assert.True(tc.ExpectedState.NextClose.Equal(state[0].NextClose), "next close: %s", state[0].NextClose)
+	}
+}
+
+func TestLoadInvalidSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`
+protocols:
+  ssh:
+    transport: tcp
+    from_port: 22
+    to_port: 22
+rules:
+  - cidr: 10.0.0.0/16
+    schedule:
+      days: [caturday]
+      start: "02:00"
+      end: "06:00"
+`)})
+
+	assert.EqualError(err, "invalid schedule of rule '10.0.0.0/16': invalid schedule day 'caturday'")
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"path"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+)
+
+// Scope limits the security groups managed by a Config. Tagged security
+// groups outside of the inclusions or matching an exclusion are reported
+// as skipped. Names are patterns where '*' matches any characters and '?' a single one.
+type Scope struct {
+	VPCs            []string          `json:"vpcs,omitempty" yaml:"vpcs,omitempty"`
+	VPCTags         map[string]string `json:"vpc_tags,omitempty" yaml:"vpc_tags,omitempty"`
+	Names           []string          `json:"names,omitempty" yaml:"names,omitempty"`
+	Accounts        []string          `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	ExcludeVPCs     []string          `json:"exclude_vpcs,omitempty" yaml:"exclude_vpcs,omitempty"`
+	ExcludeVPCTags  map[string]string `json:"exclude_vpc_tags,omitempty" yaml:"exclude_vpc_tags,omitempty"`
+	ExcludeNames    []string          `json:"exclude_names,omitempty" yaml:"exclude_names,omitempty"`
+	ExcludeAccounts []string          `json:"exclude_accounts,omitempty" yaml:"exclude_accounts,omitempty"`
+}
+
+// VPCClient represents an EC2 client listing VPCs, required by a Scope with VPC tags
+type VPCClient interface {
+	DescribeVpcs(*ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
+}
+
+// SkippedGroup describes a tagged security group out of the Scope
+type SkippedGroup struct {
+	Group  string `json:"group"`
+	Reason string `json:"reason"`
+}
+
+// Skipped returns tagged security groups out of the Scope of the last Run of a Config (receiver)
+func (c *Config) Skipped() []*SkippedGroup {
+	return c.skipped
+}
+
+// vpcs returns IDs of VPCs included and excluded by a Scope (receiver),
+// included is nil when the Scope does not limit VPCs
+func (s *Scope) vpcs(cli VPCClient) (included, excluded map[string]bool, err error) {
+	excluded = make(map[string]bool)
+	if s == nil {
+		return nil, excluded, nil
+	}
+
+	if len(s.VPCs) > 0 || len(s.VPCTags) > 0 {
+		included = make(map[string]bool)
+		for _, id := range s.VPCs {
+			included[id] = true
+		}
+	}
+
+	if len(s.VPCTags) > 0 {
+		tagged, err := vpcIDs(cli, s.VPCTags)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error fetching vpcs of the scope")
+		}
+
+		if len(s.VPCs) > 0 {
+			included = make(map[string]bool)
+			for _, id := range intersect(aws.StringSlice(s.VPCs), tagged) {
+				included[aws.StringValue(id)] = true
+			}
+		} else {
+			for _, id := range tagged {
+				included[aws.StringValue(id)] = true
+			}
+		}
+	}
+
+	for _, id := range s.ExcludeVPCs {
+		excluded[id] = true
+	}
+
+	if len(s.ExcludeVPCTags) > 0 {
+		tagged, err := vpcIDs(cli, s.ExcludeVPCTags)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error fetching excluded vpcs of the scope")
+		}
+
+		for _, id := range tagged {
+			excluded[aws.StringValue(id)] = true
+		}
+	}
+
+	return included, excluded, nil
+}
+
+// skip returns the reason a security group is out of a Scope (receiver),
+// or an empty string
+func (s *Scope) skip(group *ec2.SecurityGroup, included, excluded map[string]bool) string {
+	if s == nil {
+		return ""
+	}
+
+	vpc := aws.StringValue(group.VpcId)
+	if included != nil && !included[vpc] {
+		return "vpc '" + vpc + "' is not included"
+	}
+	if excluded[vpc] {
+		return "vpc '" + vpc + "' is excluded"
+	}
+
+	name := aws.StringValue(group.GroupName)
+	if len(s.Names) > 0 && match(s.Names, name) == "" {
+		return "name '" + name + "' matches no included pattern"
+	}
+	if pattern := match(s.ExcludeNames, name); pattern != "" {
+		return "name '" + name + "' matches excluded pattern '" + pattern + "'"
+	}
+
+	owner := aws.StringValue(group.OwnerId)
+	if len(s.Accounts) > 0 && !contains(s.Accounts, owner) {
+		return "account '" + owner + "' is not included"
+	}
+	if contains(s.ExcludeAccounts, owner) {
+		return "account '" + owner + "' is excluded"
+	}
+
+	return ""
+}
+
+// validate name patterns of a Scope (receiver)
+func (s *Scope) validate() error {
+	if s == nil {
+		return nil
+	}
+
+	for _, pattern := range append(append([]string{}, s.Names...), s.ExcludeNames...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("invalid scope name pattern '%s'", pattern)
+		}
+	}
+
+	return nil
+}
+
+// vpcIDs returns IDs of VPCs having all tags
+func vpcIDs(cli VPCClient, tags map[string]string) ([]*string, error) {
+	if cli == nil {
+		return nil, errors.New("client cannot describe vpcs")
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := make([]*ec2.Filter, 0, len(keys))
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+
+	l := []*string{}
+	var token *string
+
+	for {
+		o, err := cli.DescribeVpcs(&ec2.DescribeVpcsInput{
+			MaxResults: aws.Int64(1000),
+			Filters:    filters,
+			NextToken:  token,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, vpc := range o.Vpcs {
+			l = append(l, vpc.VpcId)
+		}
+
+		if o.NextToken == nil {
+			break
+		}
+		token = o.NextToken
+	}
+
+	return l, nil
+}
+
+// match returns the first pattern matching a name, or an empty string
+func match(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+
+	return ""
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func intersect(a, b []*string) []*string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[aws.StringValue(s)] = true
+	}
+
+	l := make([]*string, 0)
+	for _, s := range a {
+		if in[aws.StringValue(s)] {
+			l = append(l, s)
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,172 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+type vpcClient struct {
+	*mocks.SG
+	*mocks.VPC
+}
+
+func TestScope(t *testing.T) {
+	assert := assert.New(t)
+
+	tagKey := &ec2.Filter{
+		Name:   aws.String("tag-key"),
+		Values: []*string{aws.String("ssh")},
+	}
+
+	type test struct {
+		Scope           *app.Scope
+		TaggedVPCs      []string
+		ExpectedSkipped []*app.SkippedGroup
+	}
+
+	suite := map[string]test{
+		"No Scope": {
+			Scope:           nil,
+			ExpectedSkipped: []*app.SkippedGroup{},
+		},
+		"Inclusions": {
+			Scope: &app.Scope{
+				VPCs:     []string{"vpc-1", "vpc-2"},
+				Names:    []string{"web*"},
+				Accounts: []string{"111111111111"},
+			},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-2", Reason: "account '222222222222' is not included"},
+			},
+		},
+		"Included Names": {
+			Scope: &app.Scope{
+				Names: []string{"prod-*"},
+			},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-1", Reason: "name 'web-sandbox' matches no included pattern"},
+				{Group: "sg-2", Reason: "name 'web' matches no included pattern"},
+			},
+		},
+		"Included VPC Tags": {
+			Scope: &app.Scope{
+				VPCs:    []string{"vpc-1", "vpc-2"},
+				VPCTags: map[string]string{"env": "production"},
+			},
+			TaggedVPCs: []string{"vpc-2", "vpc-3"},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-1", Reason: "vpc 'vpc-1' is not included"},
+			},
+		},
+		"Included VPC Tags Without Match": {
+			Scope: &app.Scope{
+				VPCTags: map[string]string{"env": "production"},
+			},
+			TaggedVPCs: []string{},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-1", Reason: "vpc 'vpc-1' is not included"},
+				{Group: "sg-2", Reason: "vpc 'vpc-2' is not included"},
+			},
+		},
+		"Excluded VPC Tags": {
+			Scope: &app.Scope{
+				ExcludeVPCTags: map[string]string{"env": "sandbox"},
+			},
+			TaggedVPCs: []string{"vpc-1"},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-1", Reason: "vpc 'vpc-1' is excluded"},
+			},
+		},
+		"Excluded Names And Accounts": {
+			Scope: &app.Scope{
+				ExcludeNames:    []string{"*-sandbox"},
+				ExcludeAccounts: []string{"222222222222"},
+			},
+			ExpectedSkipped: []*app.SkippedGroup{
+				{Group: "sg-1", Reason: "name 'web-sandbox' matches excluded pattern '*-sandbox'"},
+				{Group: "sg-2", Reason: "account '222222222222' is excluded"},
+			},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules: []*app.Rule{},
+			Scope: tc.Scope,
+		}
+
+		managed := []*ec2.Tag{{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)}}
+
+		m := new(mocks.SG)
+		v := new(mocks.VPC)
+		if tc.TaggedVPCs != nil {
+			vpcs := make([]*ec2.Vpc, 0)
+			for _, id := range tc.TaggedVPCs {
+				vpcs = append(vpcs, &ec2.Vpc{VpcId: aws.String(id)})
+			}
+			v.On("DescribeVpcs", mock.Anything).Return(&ec2.DescribeVpcsOutput{Vpcs: vpcs}, nil).Once()
+		}
+
+		// inclusions are evaluated on security groups fetched by tag key only
+		m.On("DescribeSecurityGroups", &ec2.DescribeSecurityGroupsInput{
+			MaxResults: aws.Int64(100),
+			Filters:    []*ec2.Filter{tagKey},
+		}).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				{GroupId: aws.String("sg-1"), GroupName: aws.String("web-sandbox"), VpcId: aws.String("vpc-1"), OwnerId: aws.String("111111111111"), Tags: managed},
+				{GroupId: aws.String("sg-2"), GroupName: aws.String("web"), VpcId: aws.String("vpc-2"), OwnerId: aws.String("222222222222"), Tags: managed},
+			},
+		}, nil).Once()
+
+		assert.NoError(c.Run(&vpcClient{SG: m, VPC: v}))
+		assert.Equal(tc.ExpectedSkipped, c.Skipped())
+
+		m.AssertExpectations(t)
+		v.AssertExpectations(t)
+	}
+}
+
+func TestScopeWithoutVPCClient(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{},
+		Scope: &app.Scope{VPCTags: map[string]string{"env": "production"}},
+	}
+
+	m := new(mocks.SG)
+
+	assert.EqualError(c.Run(m), "error fetching vpcs of the scope: client cannot describe vpcs")
+
+	m.AssertExpectations(t)
+}
+
+func TestLoadInvalidScope(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader("protocols:\n  ssh: {transport: tcp, from_port: 22, to_port: 22}\nrules:\n  - cidr: 10.0.0.0/16\nscope:\n  exclude_names: ['sandbox-[']\n")})
+
+	assert.EqualError(err, "invalid scope name pattern 'sandbox-['")
+}
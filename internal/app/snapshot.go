@@ -0,0 +1,165 @@
+package app
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+// DefaultMaxRevocations is the default number of rules a restore may revoke
+const DefaultMaxRevocations = 25
+
+// Snapshot holds the managed rules of security groups at a point in time
+type Snapshot struct {
+	Time      time.Time            `json:"time"`
+	Protocols map[string]*Protocol `json:"protocols"`
+	Groups    []*GroupSnapshot     `json:"groups"`
+}
+
+// GroupSnapshot holds the managed CIDRs of every protocol of a security group
+type GroupSnapshot struct {
+	Account string              `json:"account,omitempty"`
+	Region  string              `json:"region,omitempty"`
+	Group   string              `json:"group"`
+	Rules   map[string][]string `json:"rules"`
+}
+
+// key of a security group of an account and a region
+func (g *GroupSnapshot) key() string {
+	return g.Account + "/" + g.Region + "/" + g.Group
+}
+
+// ParseSnapshot returns a validated Snapshot of a document
+func ParseSnapshot(data []byte) (*Snapshot, error) {
+	s := new(Snapshot)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrap(err, "error parsing snapshot")
+	}
+
+	if len(s.Protocols) == 0 {
+		return nil, errors.New("invalid snapshot, no protocols")
+	}
+
+	for name, proto := range s.Protocols {
+		if proto == nil || proto.Transport == nil || proto.FromPort == nil || proto.ToPort == nil {
+			return nil, errors.Errorf("invalid snapshot protocol '%s'", name)
+		}
+	}
+
+	for _, g := range s.Groups {
+		for name, cidrs := range g.Rules {
+			if _, ok := s.Protocols[name]; !ok {
+				return nil, errors.Errorf("invalid snapshot, unknown protocol '%s' of security group '%s'", name, g.Group)
+			}
+
+			for _, cidr := range cidrs {
+				if _, ok := normalizeCIDR(cidr); !ok {
+					return nil, errors.Errorf("invalid snapshot cidr '%s' of security group '%s'", cidr, g.Group)
+				}
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Restore makes runs of a Config (receiver) reconcile security groups back to
+// a Snapshot instead of the rules of the configuration. Security groups and
+// protocols which are not in the Snapshot are left untouched.
+func (c *Config) Restore(s *Snapshot) {
+	c.Protocols = s.Protocols
+	c.restore = make(map[string]*GroupSnapshot, len(s.Groups))
+	for _, g := range s.Groups {
+		c.restore[g.key()] = g
+	}
+}
+
+// Snapshot returns the managed rules captured by runs of a Config (receiver)
+func (c *Config) Snapshot() *Snapshot {
+	j := c.journal()
+
+	j.mu.Lock()
+	groups := append([]*GroupSnapshot{}, j.snapshots...)
+	j.mu.Unlock()
+
+	sort.Slice(groups, func(a, b int) bool {
+		return groups[a].key() < groups[b].key()
+	})
+
+	return &Snapshot{
+		Time:      c.now(),
+		Protocols: c.Protocols,
+		Groups:    groups,
+	}
+}
+
+// capture the managed rules of every protocol of a security group
+func (c *Config) capture(cli sg.Client, group *ec2.SecurityGroup) {
+	g := &GroupSnapshot{
+		Account: c.account,
+		Region:  c.region,
+		Group:   aws.StringValue(group.GroupId),
+		Rules:   make(map[string][]string),
+	}
+
+	for _, name := range c.protocolsOf(group) {
+		_, cidrs := c.getManagedRules(cli, c.Protocols[name], group)
+		sort.Strings(cidrs)
+		g.Rules[name] = cidrs
+	}
+
+	j := c.journal()
+	j.mu.Lock()
+	j.snapshots = append(j.snapshots, g)
+	j.mu.Unlock()
+}
+
+// restored returns the Snapshot of a security group, nil when it is missing
+func (c *Config) restored(group *ec2.SecurityGroup) *GroupSnapshot {
+	key := (&GroupSnapshot{Account: c.account, Region: c.region, Group: aws.StringValue(group.GroupId)}).key()
+
+	return c.restore[key]
+}
+
+// revocable reserves n revocations of a restore, failing when the rules
+// revoked by a Config (receiver) and its copies would exceed the limit
+func (c *Config) revocable(n int) error {
+	limit := c.maxRevocations
+	if limit == 0 {
+		limit = DefaultMaxRevocations
+	}
+
+	j := c.journal()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.revocations+n > limit {
+		return errors.Errorf("restore would revoke more than %d rules, review it with dry_run and raise max_revocations", limit)
+	}
+	j.revocations += n
+
+	return nil
+}
+
+// whitelist returns the rules of a protocol of a security group,
+// taken from the restored Snapshot when there is one
+func (c *Config) whitelist(log *logger.Entry, group *ec2.SecurityGroup, protocol string) []*Rule {
+	if c.restore == nil {
+		return c.rulesFor(log, group)
+	}
+
+	cidrs := c.restored(group).Rules[protocol]
+	rules := make([]*Rule, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		rules = append(rules, &Rule{CIDR: aws.String(cidr)})
+	}
+
+	return rules
+}
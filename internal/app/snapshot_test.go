@@ -0,0 +1,309 @@
+package app_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func managedGroup(id string, protocols []string, permissions ...*ec2.IpPermission) *ec2.SecurityGroup {
+	group := &ec2.SecurityGroup{
+		GroupId:       aws.String(id),
+		IpPermissions: permissions,
+	}
+	for _, name := range protocols {
+		group.Tags = append(group.Tags, &ec2.Tag{Key: aws.String(name), Value: aws.String(app.TagProtocolValue)})
+	}
+
+	return group
+}
+
+func managedPermission(port int64, cidrs ...string) *ec2.IpPermission {
+	permission := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(port),
+		ToPort:     aws.Int64(port),
+	}
+	for _, cidr := range cidrs {
+		permission.IpRanges = append(permission.IpRanges, &ec2.IpRange{CidrIp: aws.String(cidr), Description: aws.String(app.RuleDescription)})
+	}
+
+	return permission
+}
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	protocols := map[string]*app.Protocol{
+		"http": {Transport: aws.String("tcp"), FromPort: aws.Int64(80), ToPort: aws.Int64(80)},
+		"ssh":  {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+	}
+
+	c := &app.Config{
+		Protocols: protocols,
+		Rules: []*app.Rule{
+			{CIDR: aws.String("172.16.0.0/12")},
+		},
+	}
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	app.SetClock(c, func() time.Time { return now })
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			managedGroup("sg-2", []string{"ssh"}),
+			managedGroup("sg-1", []string{"ssh", "http"},
+				managedPermission(22, "192.168.0.0/16", "10.0.0.0/16"),
+				managedPermission(80, "10.0.0.0/16"),
+			),
+		},
+	}, nil).Once()
+
+	assert.NoError(c.Apply(&app.Invocation{Snapshot: "snapshot.json"}))
+	assert.NoError(c.Run(m))
+
+	assert.Equal(&app.Snapshot{
+		Time:      now,
+		Protocols: protocols,
+		Groups: []*app.GroupSnapshot{
+			{Group: "sg-1", Rules: map[string][]string{"http": {"10.0.0.0/16"}, "ssh": {"10.0.0.0/16", "192.168.0.0/16"}}},
+			{Group: "sg-2", Rules: map[string][]string{"ssh": {}}},
+		},
+	}, c.Snapshot())
+	assert.Empty(c.Changes())
+
+	m.AssertExpectations(t)
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	data := `{
+		"time": "2026-10-19T08:00:00Z",
+		"protocols": {"ssh": {"transport": "tcp", "from_port": 22, "to_port": 22}},
+		"groups": [{"group": "sg-1", "rules": {"ssh": ["10.0.0.0/16", "192.168.0.0/16"]}}]
+	}`
+
+	type test struct {
+		DryRun          bool
+		ExpectedChanges []string
+	}
+
+	suite := map[string]test{
+		"Restore": {
+			DryRun: false,
+			ExpectedChanges: []string{
+				"removed 172.16.0.0/12 on ssh of sg-1",
+				"added 192.168.0.0/16 on ssh of sg-1",
+			},
+		},
+		"Dry Run": {
+			DryRun:          true,
+			ExpectedChanges: []string{},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		snapshot, err := app.ParseSnapshot([]byte(data))
+		if !assert.NoError(err) {
+			return
+		}
+
+		// the configuration no longer matches the snapshot
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh":   {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+				"https": {Transport: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443)},
+			},
+			Rules: []*app.Rule{
+				{CIDR: aws.String("172.16.0.0/12")},
+			},
+		}
+		c.Restore(snapshot)
+		assert.NoError(c.Apply(&app.Invocation{Restore: "snapshot.json", DryRun: tc.DryRun}))
+
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				managedGroup("sg-1", []string{"ssh"}, managedPermission(22, "10.0.0.0/16", "172.16.0.0/12")),
+				managedGroup("sg-2", []string{"ssh"}, managedPermission(22, "10.0.0.0/16")),
+			},
+		}, nil).Once()
+		if !tc.DryRun {
+			m.On("RevokeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.RevokeSecurityGroupIngressInput) bool {
+				return *input.GroupId == "sg-1" && *input.IpPermissions[0].IpRanges[0].CidrIp == "172.16.0.0/12"
+			})).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+			m.On("AuthorizeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.AuthorizeSecurityGroupIngressInput) bool {
+				return *input.GroupId == "sg-1" && *input.IpPermissions[0].IpRanges[0].CidrIp == "192.168.0.0/16"
+			})).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+		}
+
+		assert.NoError(c.Run(m))
+
+		changes := make([]string, 0)
+		for _, ch := range c.Changes() {
+			changes = append(changes, ch.String())
+		}
+		assert.Equal(tc.ExpectedChanges, changes)
+
+		m.AssertExpectations(t)
+	}
+}
+
+func TestRestoreRevocationLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	snapshot := &app.Snapshot{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Groups: []*app.GroupSnapshot{
+			{Group: "sg-1", Rules: map[string][]string{"ssh": {"10.0.0.0/16"}}},
+			{Group: "sg-2", Rules: map[string][]string{"ssh": {}}},
+		},
+	}
+
+	c := new(app.Config)
+	c.Restore(snapshot)
+	assert.NoError(c.Apply(&app.Invocation{Restore: "snapshot.json", MaxRevocations: 2}))
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			managedGroup("sg-1", []string{"ssh"}, managedPermission(22, "10.0.0.0/16", "172.16.0.0/12")),
+			managedGroup("sg-2", []string{"ssh"}, managedPermission(22, "10.0.0.0/16", "192.168.0.0/16")),
+		},
+	}, nil).Once()
+	m.On("RevokeSecurityGroupIngress", mock.MatchedBy(func(input *ec2.RevokeSecurityGroupIngressInput) bool {
+		return *input.GroupId == "sg-1"
+	})).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+
+	assert.EqualError(c.Run(m), "restore would revoke more than 2 rules, review it with dry_run and raise max_revocations")
+	assert.Len(c.Changes(), 1)
+
+	m.AssertExpectations(t)
+}
+
+func TestRestoreSkipsExpansion(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := []*app.Rule{
+		{Host: "vpn.example.com"},
+		{Feed: &app.Feed{URL: "https://ip-ranges.example.com/ranges.json"}},
+	}
+
+	c := &app.Config{Rules: rules}
+	c.Restore(&app.Snapshot{})
+
+	// neither feeds nor hosts are resolved
+	assert.NoError(c.Expand(nil, nil))
+	assert.Equal(rules, c.Rules)
+}
+
+func TestRestoreSkipsProtocolsMissingFromSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	snapshot := &app.Snapshot{
+		Protocols: map[string]*app.Protocol{
+			"ssh":  {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+			"http": {Transport: aws.String("tcp"), FromPort: aws.Int64(80), ToPort: aws.Int64(80)},
+		},
+		Groups: []*app.GroupSnapshot{
+			{Group: "sg-1", Rules: map[string][]string{"ssh": {"10.0.0.0/16"}}},
+		},
+	}
+
+	c := new(app.Config)
+	c.Restore(snapshot)
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			managedGroup("sg-1", []string{"ssh", "http"},
+				managedPermission(22, "10.0.0.0/16"),
+				managedPermission(80, "10.0.0.0/16"),
+			),
+		},
+	}, nil).Once()
+
+	assert.NoError(c.Run(m))
+	assert.Empty(c.Changes())
+
+	m.AssertExpectations(t)
+}
+
+func TestParseSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Snapshot      interface{}
+		ExpectedError string
+	}
+
+	ssh := map[string]interface{}{"transport": "tcp", "from_port": 22, "to_port": 22}
+
+	suite := map[string]test{
+		"Valid": {
+			Snapshot: map[string]interface{}{
+				"protocols": map[string]interface{}{"ssh": ssh},
+				"groups":    []interface{}{map[string]interface{}{"group": "sg-1", "rules": map[string]interface{}{"ssh": []string{"10.0.0.0/16", "2001:db8::/32"}}}},
+			},
+			ExpectedError: "",
+		},
+		"No Protocols": {
+			Snapshot:      map[string]interface{}{"groups": []interface{}{}},
+			ExpectedError: "invalid snapshot, no protocols",
+		},
+		"Invalid Protocol": {
+			Snapshot: map[string]interface{}{
+				"protocols": map[string]interface{}{"ssh": map[string]interface{}{"transport": "tcp"}},
+			},
+			ExpectedError: "invalid snapshot protocol 'ssh'",
+		},
+		"Unknown Protocol": {
+			Snapshot: map[string]interface{}{
+				"protocols": map[string]interface{}{"ssh": ssh},
+				"groups":    []interface{}{map[string]interface{}{"group": "sg-1", "rules": map[string]interface{}{"rdp": []string{}}}},
+			},
+			ExpectedError: "invalid snapshot, unknown protocol 'rdp' of security group 'sg-1'",
+		},
+		"Invalid CIDR": {
+			Snapshot: map[string]interface{}{
+				"protocols": map[string]interface{}{"ssh": ssh},
+				"groups":    []interface{}{map[string]interface{}{"group": "sg-1", "rules": map[string]interface{}{"ssh": []string{"10.0.0.0/33"}}}},
+			},
+			ExpectedError: "invalid snapshot cidr '10.0.0.0/33' of security group 'sg-1'",
+		},
+		"Malformed": {
+			Snapshot:      []string{},
+			ExpectedError: "error parsing snapshot: json: cannot unmarshal array into Go value of type app.Snapshot",
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		data, _ := json.Marshal(tc.Snapshot)
+		_, err := app.ParseSnapshot(data)
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+)
+
+// Source represents a configuration backend
+type Source interface {
+	// Kind names the backend in error messages (e.g. "secret", "file")
+	Kind() string
+	// String identifies a particular source (e.g. "secret:whitelist")
+	String() string
+	// Fetch returns a raw configuration document
+	Fetch() ([]byte, error)
+}
+
+// Fallback is implemented by sources which can serve a last-known-good
+// version when the current one fails to parse or validate
+type Fallback interface {
+	HasFallback() bool
+	FetchFallback() ([]byte, error)
+}
+
+// Versioned is implemented by sources which know the version of
+// the last fetched document and whether it was a fallback
+type Versioned interface {
+	Version() (string, bool)
+}
+
+// SecretSource reads configuration from AWS Secrets Manager.
+// Fallback is either a staging label (e.g. "AWSPREVIOUS") or
+// a pinned version ID to use when the current version is invalid.
+type SecretSource struct {
+	Client   Client
+	Secret   string
+	Fallback string
+
+	version  string
+	fallback bool
+}
+
+var secretVersionID = regexp.MustCompile(`^[0-9a-fA-F-]{32,64}$`)
+
+// Kind of a Secrets Manager source
+func (s *SecretSource) Kind() string {
+	return "secret"
+}
+
+// String identifies a secret
+func (s *SecretSource) String() string {
+	return "secret:" + s.Secret
+}
+
+// Fetch the current version of a secret
+func (s *SecretSource) Fetch() ([]byte, error) {
+	s.fallback = false
+
+	return s.get(&secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(s.Secret),
+		VersionStage: aws.String("AWSCURRENT"),
+	})
+}
+
+// HasFallback reports whether a fallback version is configured
+func (s *SecretSource) HasFallback() bool {
+	return s.Fallback != ""
+}
+
+// FetchFallback fetches the fallback version of a secret
+func (s *SecretSource) FetchFallback() ([]byte, error) {
+	s.fallback = true
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(s.Secret),
+	}
+	if secretVersionID.MatchString(s.Fallback) {
+		input.VersionId = aws.String(s.Fallback)
+	} else {
+		input.VersionStage = aws.String(s.Fallback)
+	}
+
+	return s.get(input)
+}
+
+// Version ID of the last fetched secret and whether it was a fallback
+func (s *SecretSource) Version() (string, bool) {
+	return s.version, s.fallback
+}
+
+func (s *SecretSource) get(input *secretsmanager.GetSecretValueInput) ([]byte, error) {
+	o, err := s.Client.GetSecretValue(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching secret")
+	}
+
+	if o.SecretString == nil {
+		return nil, errors.New("secret has no SecretString payload (binary secrets are not supported)")
+	}
+
+	s.version = aws.StringValue(o.VersionId)
+
+	return []byte(*o.SecretString), nil
+}
+
+// FileSource reads configuration from a local file
+type FileSource struct {
+	Path string
+}
+
+// Kind of a local file source
+func (s *FileSource) Kind() string {
+	return "file"
+}
+
+// String identifies a file
+func (s *FileSource) String() string {
+	return "file:" + s.Path
+}
+
+// Fetch the content of a file
+func (s *FileSource) Fetch() ([]byte, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading file")
+	}
+
+	return data, nil
+}
+
+// ReaderSource reads configuration from a stream such as os.Stdin
+type ReaderSource struct {
+	Reader io.Reader
+}
+
+// Kind of a stream source
+func (s *ReaderSource) Kind() string {
+	return "stdin"
+}
+
+// String identifies a stream
+func (s *ReaderSource) String() string {
+	return "stdin"
+}
+
+// Fetch the whole stream
+func (s *ReaderSource) Fetch() ([]byte, error) {
+	data, err := io.ReadAll(s.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading stdin")
+	}
+
+	return data, nil
+}
+
+// ParameterSource reads configuration from an SSM Parameter Store
+// parameter. SecureString parameters are decrypted transparently.
+type ParameterSource struct {
+	Client SSMClient
+	Name   string
+}
+
+// Kind of a Parameter Store source
+func (s *ParameterSource) Kind() string {
+	return "parameter"
+}
+
+// String identifies a parameter
+func (s *ParameterSource) String() string {
+	return "ssm:" + s.Name
+}
+
+// Fetch the latest version of a parameter
+func (s *ParameterSource) Fetch() ([]byte, error) {
+	o, err := s.Client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(s.Name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching parameter")
+	}
+
+	if o.Parameter == nil || o.Parameter.Value == nil {
+		return nil, errors.New("parameter has no value")
+	}
+
+	return []byte(*o.Parameter.Value), nil
+}
+
+// ObjectSource reads configuration from an S3 object.
+// The ETag of the last fetched object is kept between invocations
+// of a warm Lambda, so an unchanged object is not downloaded again.
+type ObjectSource struct {
+	Client S3Client
+	Bucket string
+	Key    string
+
+	etag string
+	data []byte
+}
+
+// Kind of an S3 source
+func (s *ObjectSource) Kind() string {
+	return "object"
+}
+
+// String identifies an object
+func (s *ObjectSource) String() string {
+	return "s3://" + s.Bucket + "/" + s.Key
+}
+
+// Version is the ETag of the last fetched object
+func (s *ObjectSource) Version() (string, bool) {
+	return s.etag, false
+}
+
+// Fetch an object unless it has not changed since the previous call
+func (s *ObjectSource) Fetch() ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	}
+	if s.etag != "" {
+		input.IfNoneMatch = aws.String(s.etag)
+	}
+
+	o, err := s.Client.GetObject(input)
+	if err != nil {
+		if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() == http.StatusNotModified {
+			return s.data, nil
+		}
+		return nil, errors.Wrap(err, "error fetching object")
+	}
+	defer o.Body.Close()
+
+	data, err := io.ReadAll(o.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading object")
+	}
+
+	s.etag = aws.StringValue(o.ETag)
+	s.data = data
+
+	return data, nil
+}
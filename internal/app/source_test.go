@@ -0,0 +1,158 @@
+package app_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func TestParameterSource(t *testing.T) {
+	assert := assert.New(t)
+
+	input := &ssm.GetParameterInput{
+		Name:           aws.String("/whitelist"),
+		WithDecryption: aws.Bool(true),
+	}
+
+	type test struct {
+		MockOutput     *ssm.GetParameterOutput
+		MockError      error
+		ExpectedError  string
+		ExpectedOutput []byte
+	}
+
+	suite := map[string]test{
+		"Success": {
+			MockOutput: &ssm.GetParameterOutput{
+				Parameter: &ssm.Parameter{
+					Type:  aws.String(ssm.ParameterTypeSecureString),
+					Value: aws.String(`{"rules":[]}`),
+				},
+			},
+			MockError:      nil,
+			ExpectedError:  "",
+			ExpectedOutput: []byte(`{"rules":[]}`),
+		},
+		"SSM API Failure": {
+			MockOutput:     &ssm.GetParameterOutput{},
+			MockError:      errors.New("reason"),
+			ExpectedError:  "error fetching parameter: reason",
+			ExpectedOutput: nil,
+		},
+		"Empty Parameter": {
+			MockOutput:     &ssm.GetParameterOutput{},
+			MockError:      nil,
+			ExpectedError:  "parameter has no value",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.SSM)
+		m.On("GetParameter", input).Return(tc.MockOutput, tc.MockError).Once()
+
+		src := &app.ParameterSource{Client: m, Name: "/whitelist"}
+		result, err := src.Fetch()
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestObjectSource(t *testing.T) {
+	assert := assert.New(t)
+
+	first := &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("whitelist.json"),
+	}
+	second := &s3.GetObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("whitelist.json"),
+		IfNoneMatch: aws.String(`"v1"`),
+	}
+
+	type test struct {
+		MockOutput     *s3.GetObjectOutput
+		MockError      error
+		ExpectedError  string
+		ExpectedOutput []byte
+		ExpectedETag   string
+	}
+
+	suite := map[string]test{
+		"Not Modified": {
+			MockOutput:     nil,
+			MockError:      awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), 304, "id"),
+			ExpectedError:  "",
+			ExpectedOutput: []byte(`{"v":1}`),
+			ExpectedETag:   `"v1"`,
+		},
+		"Modified": {
+			MockOutput: &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader(`{"v":2}`)),
+				ETag: aws.String(`"v2"`),
+			},
+			MockError:      nil,
+			ExpectedError:  "",
+			ExpectedOutput: []byte(`{"v":2}`),
+			ExpectedETag:   `"v2"`,
+		},
+		"S3 API Failure": {
+			MockOutput:     nil,
+			MockError:      errors.New("reason"),
+			ExpectedError:  "error fetching object: reason",
+			ExpectedOutput: nil,
+			ExpectedETag:   `"v1"`,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.S3)
+		m.On("GetObject", first).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader(`{"v":1}`)),
+			ETag: aws.String(`"v1"`),
+		}, nil).Once()
+		m.On("GetObject", second).Return(tc.MockOutput, tc.MockError).Once()
+
+		src := &app.ObjectSource{Client: m, Bucket: "bucket", Key: "whitelist.json"}
+		if _, err := src.Fetch(); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := src.Fetch()
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOutput, result)
+		etag, _ := src.Version()
+		assert.Equal(tc.ExpectedETag, etag)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// rulesFor returns the rules of a Config (receiver) adjusted by the
+// TagExclude and TagExtra tags of a security group
+func (c *Config) rulesFor(log *logger.Entry, group *ec2.SecurityGroup) []*Rule {
+	if c.ignoreOverrides {
+		return c.Rules
+	}
+
+	exclude := c.excluded(group)
+
+	all := c.Rules
+	for _, name := range tagList(group, c.overrideTag(TagExtra)) {
+		set, ok := c.RuleSets[name]
+		if !ok {
+			log.Warnf("unknown rule set '%s' in tag '%s'", name, c.overrideTag(TagExtra))
+			continue
+		}
+		all = append(append([]*Rule{}, all...), set...)
+	}
+	all = unique(all)
+
+	if len(exclude) == 0 {
+		return all
+	}
+
+	rules := make([]*Rule, 0, len(all))
+	for _, rule := range all {
+		if exclude[rule.Name] || exclude[aws.StringValue(rule.CIDR)] {
+			log.Infof("rule '%s' is excluded by tag '%s'", rule.key(), c.overrideTag(TagExclude))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// excluded returns rule names and CIDRs a security group opts out of with the TagExclude tag
+func (c *Config) excluded(group *ec2.SecurityGroup) map[string]bool {
+	exclude := make(map[string]bool)
+	for _, name := range tagList(group, c.overrideTag(TagExclude)) {
+		exclude[name] = true
+	}
+
+	return exclude
+}
+
+// unique returns rules without repeated CIDRs, compared in their canonical
+// form, keeping the first rule of every CIDR
+func unique(all []*Rule) []*Rule {
+	rules := make([]*Rule, 0, len(all))
+	seen := make(map[string]bool)
+
+	for _, rule := range all {
+		cidr := aws.StringValue(rule.CIDR)
+		if normalized, ok := normalizeCIDR(cidr); ok {
+			cidr = normalized
+		}
+
+		if seen[cidr] {
+			continue
+		}
+		seen[cidr] = true
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// tagKey returns the tag key marking security groups managed for a protocol
+func (c *Config) tagKey(protocol string) string {
+	template := c.TagKey
+	if template == "" {
+		template = TagKeyTemplate
+	}
+
+	return strings.ReplaceAll(template, "{protocol}", protocol)
+}
+
+// tagValue returns the tag value marking security groups as managed
+func (c *Config) tagValue() string {
+	if c.TagValue == "" {
+		return TagProtocolValue
+	}
+
+	return c.TagValue
+}
+
+// overrideTag returns the key of an override tag with the configured prefix
+func (c *Config) overrideTag(tag string) string {
+	if c.TagPrefix == "" {
+		return tag
+	}
+
+	return c.TagPrefix + strings.TrimPrefix(tag, TagPrefix)
+}
+
+// description returns the description marking rules as managed
+func (c *Config) description() string {
+	if c.RuleDescription == "" {
+		return RuleDescription
+	}
+
+	return c.RuleDescription
+}
+
+// validateTags checks the tag key template of a Config (receiver)
+func (c *Config) validateTags() error {
+	if c.TagKey != "" && !strings.Contains(c.TagKey, "{protocol}") {
+		return errors.Errorf("invalid tag_key '%s', expected a '{protocol}' placeholder", c.TagKey)
+	}
+
+	return nil
+}
+
+// allRules returns the rules of a Config (receiver) and of all its rule sets
+func (c *Config) allRules() []*Rule {
+	all := append([]*Rule{}, c.Rules...)
+	for _, set := range c.RuleSets {
+		all = append(all, set...)
+	}
+
+	return all
+}
+
+// paused reports whether management of a security group is paused
+func (c *Config) paused(group *ec2.SecurityGroup) bool {
+	value, ok := tagValue(group, c.overrideTag(TagPaused))
+
+	return ok && strings.EqualFold(value, "true")
+}
+
+// tagList returns the values of a list tag separated by commas or spaces
+func tagList(group *ec2.SecurityGroup, key string) []string {
+	value, _ := tagValue(group, key)
+
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+func tagValue(group *ec2.SecurityGroup, key string) (string, bool) {
+	for _, tag := range group.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value), true
+		}
+	}
+
+	return "", false
+}
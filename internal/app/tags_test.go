@@ -0,0 +1,223 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func TestOverrideTags(t *testing.T) {
+	assert := assert.New(t)
+
+	owned := func(cidr string) *ec2.IpPermission {
+		return &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(22),
+			ToPort:     aws.Int64(22),
+			IpRanges: []*ec2.IpRange{
+				{
+					CidrIp:      aws.String(cidr),
+					Description: aws.String(app.RuleDescription),
+				},
+			},
+		}
+	}
+
+	type test struct {
+		Tags           []*ec2.Tag
+		ExpectedRevoke []*ec2.IpPermission
+		ExpectedAdd    []*ec2.IpPermission
+	}
+
+	suite := map[string]test{
+		"No Tags": {
+			Tags:           nil,
+			ExpectedRevoke: nil,
+			ExpectedAdd:    []*ec2.IpPermission{owned("192.168.0.0/16")},
+		},
+		"Paused": {
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagPaused), Value: aws.String("True")},
+			},
+			ExpectedRevoke: nil,
+			ExpectedAdd:    nil,
+		},
+		"Exclude By Name And CIDR": {
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagExclude), Value: aws.String("office, 192.168.0.0/16")},
+			},
+			ExpectedRevoke: []*ec2.IpPermission{owned("10.0.0.0/16")},
+			ExpectedAdd:    nil,
+		},
+		"Extra Rule Set": {
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagExtra), Value: aws.String("contractors unknown")},
+			},
+			ExpectedRevoke: nil,
+			ExpectedAdd:    []*ec2.IpPermission{owned("192.168.0.0/16"), owned("203.0.113.0/24")},
+		},
+		"Overlapping Rule Sets": {
+			Tags: []*ec2.Tag{
+				{Key: aws.String(app.TagExtra), Value: aws.String("contractors vendors")},
+			},
+			ExpectedRevoke: nil,
+			ExpectedAdd:    []*ec2.IpPermission{owned("192.168.0.0/16"), owned("203.0.113.0/24")},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols: map[string]*app.Protocol{
+				"ssh": {
+					Transport: aws.String("tcp"),
+					FromPort:  aws.Int64(22),
+					ToPort:    aws.Int64(22),
+				},
+			},
+			Rules: []*app.Rule{
+				{Name: "office", CIDR: aws.String("10.0.0.0/16")},
+				{CIDR: aws.String("192.168.0.0/16")},
+			},
+			RuleSets: map[string][]*app.Rule{
+				"contractors": {
+					{CIDR: aws.String("203.0.113.0/24")},
+				},
+				"vendors": {
+					{CIDR: aws.String("192.168.0.0/16")},
+					{CIDR: aws.String("203.0.113.0/24")},
+				},
+			},
+		}
+
+		m := new(mocks.SG)
+		m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+			SecurityGroups: []*ec2.SecurityGroup{
+				{
+					GroupId:       aws.String("sg-1"),
+					Tags:          append([]*ec2.Tag{{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)}}, tc.Tags...),
+					IpPermissions: []*ec2.IpPermission{owned("10.0.0.0/16")},
+				},
+			},
+		}, nil).Once()
+		if tc.ExpectedRevoke != nil {
+			m.On("RevokeSecurityGroupIngress", &ec2.RevokeSecurityGroupIngressInput{
+				DryRun:        aws.Bool(false),
+				GroupId:       aws.String("sg-1"),
+				IpPermissions: tc.ExpectedRevoke,
+			}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+		}
+		if tc.ExpectedAdd != nil {
+			m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+				DryRun:        aws.Bool(false),
+				GroupId:       aws.String("sg-1"),
+				IpPermissions: tc.ExpectedAdd,
+			}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+		}
+
+		assert.NoError(c.Run(m))
+
+		m.AssertExpectations(t)
+		if tc.ExpectedRevoke == nil {
+			m.AssertNotCalled(t, "RevokeSecurityGroupIngress", mock.Anything)
+		}
+		if tc.ExpectedAdd == nil {
+			m.AssertNotCalled(t, "AuthorizeSecurityGroupIngress", mock.Anything)
+		}
+	}
+}
+
+func TestCustomNaming(t *testing.T) {
+	assert := assert.New(t)
+
+	rule := func(cidr, description string) *ec2.IpPermission {
+		return &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(443),
+			ToPort:     aws.Int64(443),
+			IpRanges: []*ec2.IpRange{
+				{
+					CidrIp:      aws.String(cidr),
+					Description: aws.String(description),
+				},
+			},
+		}
+	}
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"https": {
+				Transport: aws.String("tcp"),
+				FromPort:  aws.Int64(443),
+				ToPort:    aws.Int64(443),
+			},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+			{Name: "lab", CIDR: aws.String("172.16.0.0/12")},
+		},
+		TagKey:          "sgm/{protocol}",
+		TagValue:        "platform",
+		TagPrefix:       "platform:",
+		RuleDescription: "platform-owned",
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", &ec2.DescribeSecurityGroupsInput{
+		MaxResults: aws.Int64(100),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String("sgm/https")},
+			},
+		},
+	}).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("https"), Value: aws.String("public")},
+					{Key: aws.String("sgm/https"), Value: aws.String("platform")},
+					{Key: aws.String("platform:exclude"), Value: aws.String("lab")},
+					{Key: aws.String(app.TagPaused), Value: aws.String("true")},
+				},
+				IpPermissions: []*ec2.IpPermission{
+					rule("192.168.0.0/16", app.RuleDescription),
+					rule("198.51.100.0/24", "platform-owned"),
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("RevokeSecurityGroupIngress", &ec2.RevokeSecurityGroupIngressInput{
+		DryRun:        aws.Bool(false),
+		GroupId:       aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{rule("198.51.100.0/24", "platform-owned")},
+	}).Return(&ec2.RevokeSecurityGroupIngressOutput{}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", &ec2.AuthorizeSecurityGroupIngressInput{
+		DryRun:        aws.Bool(false),
+		GroupId:       aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{rule("10.0.0.0/16", "platform-owned")},
+	}).Return(&ec2.AuthorizeSecurityGroupIngressOutput{}, nil).Once()
+
+	assert.NoError(c.Run(m))
+
+	m.AssertExpectations(t)
+}
+
+func TestLoadInvalidTagKey(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"tag_key":"sgm","protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid tag_key 'sgm', expected a '{protocol}' placeholder")
+}
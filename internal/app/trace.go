@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
+)
+
+// TracerName identifies spans of this application
+const TracerName = "github.com/ReasonSoftware/security-group-manager"
+
+// span attribute keys
+const (
+	AttributeGroup    = attribute.Key("security_group.id")
+	AttributeProtocol = attribute.Key("protocol")
+	AttributeAccount  = attribute.Key("account")
+	AttributeRegion   = attribute.Key("region")
+)
+
+// NewTracerProvider returns a TracerProvider exporting spans over OTLP/HTTP
+// to the endpoint set by the standard OTEL_EXPORTER_OTLP_* variables
+func NewTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", SessionName))),
+	), nil
+}
+
+// SetContext sets the parent context of the spans of a Config (receiver)
+func (c *Config) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// start a span under the context of a Config (receiver),
+// labelled with the account and region it reconciles
+func (c *Config) start(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if c.account != "" {
+		attrs = append(attrs, AttributeAccount.String(c.account))
+	}
+	if c.region != "" {
+		attrs = append(attrs, AttributeRegion.String(c.region))
+	}
+
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// end a span, recording an error
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceHook adds the trace and span IDs of the context of a log entry
+type TraceHook struct{}
+
+// Levels of log entries handled by the hook
+func (TraceHook) Levels() []logger.Level {
+	return logger.AllLevels
+}
+
+// Fire adds the IDs to a log entry
+func (TraceHook) Fire(entry *logger.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+
+	entry.Data["trace_id"] = sc.TraceID().String()
+	entry.Data["span_id"] = sc.SpanID().String()
+
+	return nil
+}
+
+// tracedClient starts a span around every EC2 call
+type tracedClient struct {
+	cli   sg.Client
+	ctx   context.Context
+	attrs []attribute.KeyValue
+}
+
+// traced returns a client starting its spans under a context
+func traced(ctx context.Context, cli sg.Client, attrs ...attribute.KeyValue) sg.Client {
+	if t, ok := cli.(*tracedClient); ok {
+		cli = t.cli
+	}
+
+	return &tracedClient{cli: cli, ctx: ctx, attrs: attrs}
+}
+
+func (t *tracedClient) start(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := otel.Tracer(TracerName).Start(t.ctx, "ec2."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, t.attrs...)...),
+	)
+
+	return span
+}
+
+func (t *tracedClient) AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	span := t.start("AuthorizeSecurityGroupIngress", AttributeGroup.String(aws.StringValue(input.GroupId)))
+	o, err := t.cli.AuthorizeSecurityGroupIngress(input)
+	end(span, err)
+
+	return o, err
+}
+
+func (t *tracedClient) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	span := t.start("RevokeSecurityGroupIngress", AttributeGroup.String(aws.StringValue(input.GroupId)))
+	o, err := t.cli.RevokeSecurityGroupIngress(input)
+	end(span, err)
+
+	return o, err
+}
+
+func (t *tracedClient) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	span := t.start("DescribeSecurityGroups")
+	o, err := t.cli.DescribeSecurityGroups(input)
+	end(span, err)
+
+	return o, err
+}
+
+func (t *tracedClient) DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	vpcs, ok := t.cli.(VPCClient)
+	if !ok {
+		return nil, errors.New("client cannot describe vpcs")
+	}
+
+	span := t.start("DescribeVpcs")
+	o, err := vpcs.DescribeVpcs(input)
+	end(span, err)
+
+	return o, err
+}
@@ -0,0 +1,196 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	collector "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+// span is an exported span as received by a collector
+type span struct {
+	Name       string
+	Parent     string
+	Trace      string
+	Attributes map[string]string
+}
+
+// collect spans exported over OTLP/HTTP by a local collector
+func collect(t *testing.T) (*httptest.Server, func() map[string]*span) {
+	var mu sync.Mutex
+	spans := make(map[string]*span)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var request collector.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &request); err != nil {
+			t.Errorf("error decoding spans: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resource := range request.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, s := range scope.Spans {
+					spans[hex.EncodeToString(s.SpanId)] = decodeSpan(s)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&collector.ExportTraceServiceResponse{})
+		_, _ = w.Write(out)
+	}))
+
+	return server, func() map[string]*span {
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func decodeSpan(s *v1.Span) *span {
+	attrs := make(map[string]string)
+	for _, kv := range s.Attributes {
+		array := kv.Value.GetArrayValue()
+		if array == nil {
+			attrs[kv.Key] = kv.Value.GetStringValue()
+			continue
+		}
+
+		var values []string
+		for _, item := range array.GetValues() {
+			values = append(values, item.GetStringValue())
+		}
+		out, _ := json.Marshal(values)
+		attrs[kv.Key] = string(out)
+	}
+
+	return &span{
+		Name:       s.Name,
+		Parent:     hex.EncodeToString(s.ParentSpanId),
+		Trace:      hex.EncodeToString(s.TraceId),
+		Attributes: attrs,
+	}
+}
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	server, spans := collect(t)
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+
+	provider, err := app.NewTracerProvider(context.Background())
+	if !assert.NoError(err) {
+		return
+	}
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	c := &app.Config{
+		Protocols: map[string]*app.Protocol{
+			"ssh": {Transport: aws.String("tcp"), FromPort: aws.Int64(22), ToPort: aws.Int64(22)},
+		},
+		Rules: []*app.Rule{
+			{CIDR: aws.String("10.0.0.0/16")},
+		},
+	}
+
+	m := new(mocks.SG)
+	m.On("DescribeSecurityGroups", mock.Anything).Return(&ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1"),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("ssh"), Value: aws.String(app.TagProtocolValue)},
+				},
+			},
+		},
+	}, nil).Once()
+	m.On("AuthorizeSecurityGroupIngress", mock.Anything).Return(nil, errors.New("reason")).Once()
+
+	ctx, root := otel.Tracer(app.TracerName).Start(context.Background(), "handler")
+	c.SetContext(ctx)
+	assert.EqualError(c.Run(m), "error adding a cidr '10.0.0.0/16' to a security group: reason")
+	root.End()
+
+	assert.NoError(provider.ForceFlush(context.Background()))
+	assert.NoError(provider.Shutdown(context.Background()))
+
+	byName := make(map[string]*span)
+	ids := make(map[string]string)
+	for id, s := range spans() {
+		byName[s.Name] = s
+		ids[s.Name] = id
+		assert.Equal(root.SpanContext().TraceID().String(), s.Trace, s.Name)
+	}
+
+	if !assert.Len(byName, 5) {
+		return
+	}
+
+	assert.Equal(ids["handler"], byName["fetch"].Parent)
+	assert.Equal(ids["fetch"], byName["ec2.DescribeSecurityGroups"].Parent)
+	assert.Equal(ids["handler"], byName["manage"].Parent)
+	assert.Equal(map[string]string{"security_group.id": "sg-1", "protocol": `["ssh"]`}, byName["manage"].Attributes)
+	assert.Equal(ids["manage"], byName["ec2.AuthorizeSecurityGroupIngress"].Parent)
+	assert.Equal(map[string]string{"security_group.id": "sg-1", "protocol": `["ssh"]`}, byName["ec2.AuthorizeSecurityGroupIngress"].Attributes)
+
+	m.AssertExpectations(t)
+}
+
+func TestTraceHook(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	log := logrus.New()
+	log.SetFormatter(&logrus.JSONFormatter{DisableTimestamp: true})
+	log.SetOutput(&out)
+	log.AddHook(app.TraceHook{})
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, s := provider.Tracer(app.TracerName).Start(context.Background(), "handler")
+	s.End()
+
+	log.WithContext(ctx).Info("traced")
+	log.Info("untraced")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if !assert.Len(lines, 2) {
+		return
+	}
+
+	var traced, untraced map[string]string
+	assert.NoError(json.Unmarshal(lines[0], &traced))
+	assert.NoError(json.Unmarshal(lines[1], &untraced))
+
+	assert.Equal(s.SpanContext().TraceID().String(), traced["trace_id"])
+	assert.Equal(s.SpanContext().SpanID().String(), traced["span_id"])
+	assert.NotContains(untraced, "trace_id")
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// UpdateEvents are CloudTrail events of a secret update triggering a full run
+var UpdateEvents = []string{
+	"PutSecretValue",
+	"UpdateSecret",
+}
+
+var secretARN = regexp.MustCompile(`^arn:aws[a-z-]*:secretsmanager:[^:]*:\d{12}:secret:(.+)-[0-9A-Za-z]{6}$`)
+
+// SecretUpdate is an update of a secret recorded by CloudTrail
+type SecretUpdate struct {
+	Event   string    `json:"event"`
+	Secret  string    `json:"secret"`
+	Version string    `json:"version,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type secretTrailEvent struct {
+	EventName         string    `json:"eventName"`
+	EventTime         time.Time `json:"eventTime"`
+	RequestParameters struct {
+		SecretID string `json:"secretId"`
+	} `json:"requestParameters"`
+	ResponseElements struct {
+		VersionID string `json:"versionId"`
+	} `json:"responseElements"`
+}
+
+// ParseSecretUpdate returns the SecretUpdate of an EventBridge event,
+// ok is false for other events (including unsupported secret events)
+// which should trigger a full run
+func ParseSecretUpdate(data []byte) (update *SecretUpdate, ok bool, err error) {
+	if len(strings.TrimSpace(string(data))) == 0 || string(data) == "null" {
+		return nil, false, nil
+	}
+
+	var e eventBridgeEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing event")
+	}
+
+	if e.Source != "aws.secretsmanager" || e.DetailType != "AWS API Call via CloudTrail" {
+		return nil, false, nil
+	}
+
+	var trail secretTrailEvent
+	if err := json.Unmarshal(e.Detail, &trail); err != nil {
+		return nil, false, errors.Wrap(err, "error parsing cloudtrail event")
+	}
+
+	supported := false
+	for _, event := range UpdateEvents {
+		supported = supported || event == trail.EventName
+	}
+
+	if !supported {
+		logger.Warnf("unsupported cloudtrail event '%s', reconciling all security groups", trail.EventName)
+		return nil, false, nil
+	}
+
+	return &SecretUpdate{
+		Event:   trail.EventName,
+		Secret:  trail.RequestParameters.SecretID,
+		Version: trail.ResponseElements.VersionID,
+		Time:    trail.EventTime,
+	}, true, nil
+}
+
+// Targets reports whether a SecretUpdate (receiver) is an update
+// of the secret of any of the sources
+func (u *SecretUpdate) Targets(srcs ...Source) bool {
+	return u.source(srcs) != nil
+}
+
+// Applied reports whether the version of a SecretUpdate (receiver) was
+// already applied by a previous run with the sources
+func (u *SecretUpdate) Applied(srcs ...Source) bool {
+	src := u.source(srcs)
+	if src == nil || u.Version == "" {
+		return false
+	}
+
+	version, fallback := src.Version()
+
+	return !fallback && version == u.Version
+}
+
+func (u *SecretUpdate) source(srcs []Source) *SecretSource {
+	for _, src := range srcs {
+		if s, ok := src.(*SecretSource); ok && secretName(s.Secret) == secretName(u.Secret) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// secretName returns the name of a secret referenced by a name or an ARN
+func secretName(id string) string {
+	if m := secretARN.FindStringSubmatch(id); m != nil {
+		return m[1]
+	}
+
+	return id
+}
+
+// RunTracker keeps the start of the last successful full run of a warm
+// Lambda, so updates already covered by a run do not trigger another one
+type RunTracker struct {
+	mu      sync.Mutex
+	started time.Time
+}
+
+// Done records a successful full run started at a given time
+func (t *RunTracker) Done(started time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if started.After(t.started) {
+		t.started = started
+	}
+}
+
+// Covers reports whether a successful full run started after a given time
+func (t *RunTracker) Covers(at time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return !at.IsZero() && t.started.After(at)
+}
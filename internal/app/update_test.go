@@ -0,0 +1,145 @@
+package app_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/mocks"
+)
+
+func secretEvent(name, secret string) string {
+	return `{
+		"source": "aws.secretsmanager",
+		"detail-type": "AWS API Call via CloudTrail",
+		"detail": {
+			"eventName": "` + name + `",
+			"eventTime": "2026-10-19T10:00:00Z",
+			"requestParameters": {"secretId": "` + secret + `"},
+			"responseElements": {"versionId": "6f7c1b2a-0000-4000-8000-000000000001"}
+		}
+	}`
+}
+
+func TestParseSecretUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	type test struct {
+		Event          string
+		ExpectedOK     bool
+		ExpectedError  string
+		ExpectedOutput *app.SecretUpdate
+	}
+
+	suite := map[string]test{
+		"Put Secret Value": {
+			Event:         secretEvent("PutSecretValue", "whitelist"),
+			ExpectedOK:    true,
+			ExpectedError: "",
+			ExpectedOutput: &app.SecretUpdate{
+				Event:   "PutSecretValue",
+				Secret:  "whitelist",
+				Version: "6f7c1b2a-0000-4000-8000-000000000001",
+				Time:    at,
+			},
+		},
+		"Update Secret": {
+			Event:         secretEvent("UpdateSecret", "whitelist"),
+			ExpectedOK:    true,
+			ExpectedError: "",
+			ExpectedOutput: &app.SecretUpdate{
+				Event:   "UpdateSecret",
+				Secret:  "whitelist",
+				Version: "6f7c1b2a-0000-4000-8000-000000000001",
+				Time:    at,
+			},
+		},
+		"Security Group Change": {
+			Event:          trailEvent("CreateTags", `{}`),
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+		"Unsupported": {
+			Event:          secretEvent("DeleteSecret", "whitelist"),
+			ExpectedOK:     false,
+			ExpectedError:  "",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		result, ok, err := app.ParseSecretUpdate([]byte(tc.Event))
+
+		if tc.ExpectedError != "" {
+			assert.EqualError(err, tc.ExpectedError)
+		} else {
+			assert.NoError(err)
+		}
+
+		assert.Equal(tc.ExpectedOK, ok)
+		assert.Equal(tc.ExpectedOutput, result)
+	}
+}
+
+func TestSecretUpdateTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	m := new(mocks.SM)
+	m.On("GetSecretValue", &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String("whitelist"),
+		VersionStage: aws.String("AWSCURRENT"),
+	}).Return(&secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String("{}"),
+		VersionId:    aws.String("6f7c1b2a-0000-4000-8000-000000000001"),
+	}, nil).Once()
+
+	src := &app.SecretSource{Client: m, Secret: "whitelist"}
+	file := &app.FileSource{Path: "whitelist"}
+
+	update := func(secret, version string) *app.SecretUpdate {
+		return &app.SecretUpdate{Event: "PutSecretValue", Secret: secret, Version: version}
+	}
+
+	assert.True(update("whitelist", "").Targets(file, src))
+	assert.True(update("arn:aws:secretsmanager:us-east-1:111111111111:secret:whitelist-a1B2c3", "").Targets(src))
+	assert.False(update("arn:aws:secretsmanager:us-east-1:111111111111:secret:other-a1B2c3", "").Targets(src))
+	assert.False(update("whitelist", "").Targets(file))
+
+	assert.False(update("whitelist", "6f7c1b2a-0000-4000-8000-000000000001").Applied(src))
+
+	_, err := src.Fetch()
+	assert.NoError(err)
+
+	assert.True(update("whitelist", "6f7c1b2a-0000-4000-8000-000000000001").Applied(src))
+	assert.False(update("whitelist", "6f7c1b2a-0000-4000-8000-000000000002").Applied(src))
+}
+
+func TestRunTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	var runs app.RunTracker
+	assert.False(runs.Covers(at))
+
+	runs.Done(at.Add(-time.Minute))
+	assert.False(runs.Covers(at))
+
+	runs.Done(at.Add(time.Second))
+	assert.True(runs.Covers(at))
+
+	runs.Done(at.Add(-time.Hour))
+	assert.True(runs.Covers(at))
+	assert.False(runs.Covers(time.Time{}))
+}
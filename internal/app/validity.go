@@ -0,0 +1,96 @@
+package app
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultExpiryWarning is the window within which expiring rules are reported
+const DefaultExpiryWarning = 7 * 24 * time.Hour
+
+// ExpiringRule describes a rule which expires soon
+type ExpiringRule struct {
+	Rule      string    `json:"rule"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// active reports whether a rule (receiver) applies at a given time
+func (r *Rule) active(now time.Time) bool {
+	if !r.inPeriod(now) {
+		return false
+	}
+
+	return r.Schedule == nil || r.Schedule.open(now)
+}
+
+// inPeriod reports whether a given time is between NotBefore and ExpiresAt
+func (r *Rule) inPeriod(now time.Time) bool {
+	if r.NotBefore != nil && now.Before(*r.NotBefore) {
+		return false
+	}
+
+	if r.ExpiresAt != nil && !now.Before(*r.ExpiresAt) {
+		return false
+	}
+
+	return true
+}
+
+// active returns rules which apply now according to the clock of a Config (receiver)
+func (c *Config) active(all []*Rule) []*Rule {
+	now := c.now()
+	rules := make([]*Rule, 0, len(all))
+
+	for _, rule := range all {
+		if rule.active(now) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// Expiring returns active rules of a Config (receiver) which expire
+// within the ExpiryWarning window
+func (c *Config) Expiring() []*ExpiringRule {
+	window, err := c.expiryWarning()
+	if err != nil {
+		window = DefaultExpiryWarning
+	}
+
+	now := c.now()
+	expiring := make([]*ExpiringRule, 0)
+
+	for _, rule := range c.allRules() {
+		if rule.ExpiresAt != nil && rule.inPeriod(now) && rule.ExpiresAt.Sub(now) <= window {
+			expiring = append(expiring, &ExpiringRule{
+				Rule:      rule.key(),
+				ExpiresAt: *rule.ExpiresAt,
+			})
+		}
+	}
+
+	return expiring
+}
+
+func (c *Config) expiryWarning() (time.Duration, error) {
+	if c.ExpiryWarning == "" {
+		return DefaultExpiryWarning, nil
+	}
+
+	d, err := time.ParseDuration(c.ExpiryWarning)
+	if err != nil {
+		return 0, errors.Errorf("invalid expiry_warning '%s'", c.ExpiryWarning)
+	}
+
+	return d, nil
+}
+
+func (c *Config) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+
+	return time.Now()
+}
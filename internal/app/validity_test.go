@@ -0,0 +1,123 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ReasonSoftware/security-group-manager/internal/app"
+)
+
+func TestTimeBoundedRules(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	proto := &app.Protocol{
+		Transport: aws.String("tcp"),
+		FromPort:  aws.Int64(22),
+		ToPort:    aws.Int64(22),
+	}
+
+	type test struct {
+		Rules            []*app.Rule
+		ExpiryWarning    string
+		ExpectedMissing  []string
+		ExpectedExpiring []*app.ExpiringRule
+	}
+
+	suite := map[string]test{
+		"Active Rule": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), NotBefore: at(-time.Hour), ExpiresAt: at(30 * 24 * time.Hour)},
+			},
+			ExpectedMissing:  []string{"10.0.0.0/16"},
+			ExpectedExpiring: []*app.ExpiringRule{},
+		},
+		"Expired Rule": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), ExpiresAt: at(-time.Second)},
+			},
+			ExpectedMissing:  []string{},
+			ExpectedExpiring: []*app.ExpiringRule{},
+		},
+		"Not Yet Active Rule": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), NotBefore: at(time.Hour), ExpiresAt: at(2 * time.Hour)},
+			},
+			ExpectedMissing:  []string{},
+			ExpectedExpiring: []*app.ExpiringRule{},
+		},
+		"Expiring Within Default Window": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), ExpiresAt: at(48 * time.Hour)},
+				{CIDR: aws.String("192.168.0.0/16")},
+			},
+			ExpectedMissing: []string{"10.0.0.0/16", "192.168.0.0/16"},
+			ExpectedExpiring: []*app.ExpiringRule{
+				{Rule: "10.0.0.0/16", ExpiresAt: *at(48 * time.Hour)},
+			},
+		},
+		"Expiring Outside Configured Window": {
+			Rules: []*app.Rule{
+				{CIDR: aws.String("10.0.0.0/16"), ExpiresAt: at(48 * time.Hour)},
+			},
+			ExpiryWarning:    "24h",
+			ExpectedMissing:  []string{"10.0.0.0/16"},
+			ExpectedExpiring: []*app.ExpiringRule{},
+		},
+	}
+
+	var counter int
+	for name, tc := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		c := &app.Config{
+			Protocols:     map[string]*app.Protocol{"ssh": proto},
+			Rules:         tc.Rules,
+			ExpiryWarning: tc.ExpiryWarning,
+		}
+		app.SetClock(c, func() time.Time { return now })
+
+		result := app.CategorizeRules(c, proto, []*ec2.IpPermission{})
+
+		assert.Equal(tc.ExpectedMissing, result.Missing.CIDRs)
+		assert.Equal(tc.ExpectedExpiring, c.Expiring())
+	}
+}
+
+func TestLoadTimeBoundedRules(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`
+expiry_warning: 72h
+protocols:
+  ssh:
+    transport: tcp
+    from_port: 22
+    to_port: 22
+rules:
+  - cidr: 203.0.113.10/32
+    note: incident responder
+    not_before: 2026-10-19T08:00:00Z
+    expires_at: 2026-10-26T08:00:00Z
+`)})
+
+	assert.NoError(err)
+	assert.Equal("72h", c.ExpiryWarning)
+	assert.Equal(time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), c.Rules[0].NotBefore.UTC())
+	assert.Equal(time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC), c.Rules[0].ExpiresAt.UTC())
+
+	_, err = app.LoadConfig(&app.ReaderSource{Reader: strings.NewReader(`{"expiry_warning":"week","protocols":{"ssh":{"transport":"tcp","from_port":22,"to_port":22}},"rules":[{"cidr":"10.0.0.0/16"}]}`)})
+
+	assert.EqualError(err, "invalid expiry_warning 'week'")
+}
@@ -1,18 +1,41 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/ReasonSoftware/security-group-manager/internal/app"
+	"github.com/ReasonSoftware/security-group-manager/pkg/sg"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 const Version string = "v2.0.1"
@@ -20,12 +43,45 @@ const Version string = "v2.0.1"
 // Cli is an authorized EC2 Client
 var Cli *ec2.EC2
 
+// OpSession is an AWS session in the operational region
+var OpSession *session.Session
+
 // SCli is an authorized Secrets Manager Client
 var SCli *secretsmanager.SecretsManager
 
+// CfgSession is an AWS session in the region holding the configuration
+var CfgSession *session.Session
+
 // Secret contains the name of the AWS Secrets Manager secret with runtime config
 var Secret string
 
+// Feeds caches published IP range feeds between invocations
+var Feeds = app.NewFeedCache(&http.Client{Timeout: 10 * time.Second}, app.DefaultFeedTTL)
+
+// Webhooks posts change notifications
+var Webhooks = &http.Client{Timeout: 10 * time.Second}
+
+// Hosts caches resolved host rules between invocations
+var Hosts *app.HostCache
+
+// Runs tracks full runs, so a secret update already applied does not trigger another one
+var Runs app.RunTracker
+
+// Roles caches credentials of assumed roles between invocations
+var Roles sync.Map
+
+// Sources are the configuration backends selected at startup, in overlay order
+var Sources []app.Source
+
+// Sinks receive an audit record of every applied change
+var Sinks []app.AuditSink
+
+// Tracer exports spans when an OTLP endpoint is configured
+var Tracer *sdktrace.TracerProvider
+
+// Account is the ID of the account of the Lambda, resolved on the first invocation
+var Account string
+
 func init() {
 	logrus.SetReportCaller(false)
 	logrus.SetFormatter(&logrus.JSONFormatter{
@@ -33,6 +89,7 @@ func init() {
 	})
 	logrus.SetOutput(os.Stdout)
 	logrus.SetLevel(parseLogLevel(os.Getenv("LOG_LEVEL")))
+	logrus.AddHook(app.TraceHook{})
 
 	ec2Region := os.Getenv("OPERATIONAL_REGION")
 	if ec2Region == "" {
@@ -47,16 +104,147 @@ func init() {
 	}
 
 	Secret = os.Getenv("SECRET")
-	if Secret == "" {
-		logrus.Fatal("SECRET environment variable is required")
-	}
 
-	Cli = ec2.New(session.Must(session.NewSession(&aws.Config{
+	Hosts = app.NewHostCache(newResolver(os.Getenv("DNS_RESOLVER")), app.DefaultHostMinTTL)
+
+	OpSession = session.Must(session.NewSession(&aws.Config{
 		Region: &ec2Region,
-	})))
-	SCli = secretsmanager.New(session.Must(session.NewSession(&aws.Config{
+	}))
+	Cli = ec2.New(OpSession)
+	CfgSession = session.Must(session.NewSession(&aws.Config{
 		Region: &smRegion,
-	})))
+	}))
+	SCli = secretsmanager.New(CfgSession)
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		var err error
+		if Tracer, err = app.NewTracerProvider(context.Background()); err != nil {
+			logrus.WithError(err).Fatal("error creating a tracer provider")
+		}
+		otel.SetTracerProvider(Tracer)
+	}
+}
+
+// newResolver returns the system resolver, or a resolver querying
+// a specific DNS server when an address (e.g. "1.1.1.1:53") is given
+func newResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// callerAccount returns the ID of the account of the Lambda, taken from the
+// ARN of the invoked function or from STS when running locally
+func callerAccount(ctx context.Context) string {
+	if Account != "" {
+		return Account
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		if function, err := arn.Parse(lc.InvokedFunctionArn); err == nil {
+			Account = function.AccountID
+			return Account
+		}
+	}
+
+	o, err := sts.New(OpSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		logrus.WithError(err).Warn("error resolving the account of the caller")
+		return ""
+	}
+	Account = aws.StringValue(o.Account)
+
+	return Account
+}
+
+// newRegionClient returns an EC2 client of a region
+func newRegionClient(region string) sg.Client {
+	return ec2.New(OpSession, aws.NewConfig().WithRegion(region))
+}
+
+// newTopicClient returns an SNS client in the region of the notifications topic
+func newTopicClient(config *app.Config) app.SNSClient {
+	cfg := aws.NewConfig()
+	if config.Notifications != nil {
+		if topic, err := arn.Parse(config.Notifications.Topic); err == nil {
+			cfg = cfg.WithRegion(topic.Region)
+		}
+	}
+
+	return sns.New(OpSession, cfg)
+}
+
+// changeClient returns an EC2 client of the account and region of a change
+func changeClient(config *app.Config, change *app.Change) sg.Client {
+	for _, account := range config.Accounts {
+		if account.ID() != "" && account.ID() == change.Account {
+			return newAccountClient(account, change.Region)
+		}
+	}
+
+	if change.Region != "" && change.Region != aws.StringValue(OpSession.Config.Region) {
+		return newRegionClient(change.Region)
+	}
+
+	return Cli
+}
+
+// knownAccount reports whether the account of a change is the account
+// of the Lambda or a listed one, so accounts need not be discovered
+func knownAccount(ctx context.Context, config *app.Config, change *app.Change) bool {
+	if change.Account == callerAccount(ctx) {
+		return true
+	}
+
+	for _, account := range config.Accounts {
+		if account.ID() == change.Account {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newAccountClient returns an EC2 client of an account in a region,
+// the operational region when empty
+func newAccountClient(account *app.Account, region string) app.EC2Client {
+	cfg := aws.NewConfig()
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+
+	if account.RoleARN != "" {
+		cfg = cfg.WithCredentials(assumeRole(account))
+	}
+
+	return ec2.New(OpSession, cfg)
+}
+
+// assumeRole returns cached credentials of the role of an account,
+// which are refreshed before they expire
+func assumeRole(account *app.Account) *credentials.Credentials {
+	key := account.RoleARN + "|" + account.ExternalID
+	if creds, ok := Roles.Load(key); ok {
+		return creds.(*credentials.Credentials)
+	}
+
+	creds := stscreds.NewCredentials(OpSession, account.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = app.SessionName
+		if account.ExternalID != "" {
+			p.ExternalID = aws.String(account.ExternalID)
+		}
+	})
+	actual, _ := Roles.LoadOrStore(key, creds)
+
+	return actual.(*credentials.Credentials)
 }
 
 func parseLogLevel(level string) logrus.Level {
@@ -72,31 +260,357 @@ func parseLogLevel(level string) logrus.Level {
 	}
 }
 
-func handler(ctx context.Context) error {
-	log := logrus.WithField("version", Version)
+// newSources selects configuration backends from a comma-separated list,
+// where every following source is an overlay on top of the previous ones
+func newSources(specs string) ([]app.Source, error) {
+	var srcs []app.Source
+
+	for _, spec := range strings.Split(specs, ",") {
+		src, err := newSource(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, src)
+	}
+
+	return srcs, nil
+}
+
+// newSource selects a configuration backend:
+// "-" reads stdin, "secret:<name>" reads a Secrets Manager secret,
+// "ssm:<name>" reads a Parameter Store parameter,
+// "s3://<bucket>/<key>" reads an S3 object, "file://<path>" or a plain
+// path reads a local file, and an empty value falls back to the
+// AWS Secrets Manager secret.
+func newSource(spec string) (app.Source, error) {
+	switch {
+	case spec == "":
+		if Secret == "" {
+			return nil, errors.New("SECRET environment variable is required")
+		}
+		return &app.SecretSource{Client: SCli, Secret: Secret, Fallback: os.Getenv("SECRET_FALLBACK")}, nil
+	case strings.HasPrefix(spec, "secret:"):
+		return &app.SecretSource{Client: SCli, Secret: strings.TrimPrefix(spec, "secret:"), Fallback: os.Getenv("SECRET_FALLBACK")}, nil
+	case strings.HasPrefix(spec, "ssm:"):
+		return &app.ParameterSource{Client: ssm.New(CfgSession), Name: strings.TrimPrefix(spec, "ssm:")}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, errors.Errorf("invalid s3 source '%s', expected 's3://<bucket>/<key>'", spec)
+		}
+		return &app.ObjectSource{Client: s3.New(CfgSession), Bucket: bucket, Key: key}, nil
+	case spec == "-":
+		return &app.ReaderSource{Reader: os.Stdin}, nil
+	default:
+		return &app.FileSource{Path: strings.TrimPrefix(spec, "file://")}, nil
+	}
+}
+
+// loadSnapshot reads a snapshot from a location accepted by newSource
+func loadSnapshot(spec string) (*app.Snapshot, error) {
+	src, err := newSource(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := src.Fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	return app.ParseSnapshot(data)
+}
+
+// saveSnapshot writes a snapshot to a location accepted by save
+func saveSnapshot(spec string, snapshot *app.Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding snapshot")
+	}
+
+	return save(spec, append(data, '\n'), "application/json")
+}
+
+// saveCompliance writes a compliance report to a location accepted by save
+func saveCompliance(spec, format string, report *app.ComplianceReport) error {
+	var buf bytes.Buffer
+	if err := report.Write(&buf, format); err != nil {
+		return errors.Wrap(err, "error encoding compliance report")
+	}
+
+	contentType := map[string]string{
+		app.FormatJSON:     "application/json",
+		app.FormatCSV:      "text/csv",
+		app.FormatMarkdown: "text/markdown",
+	}[format]
+
+	return save(spec, buf.Bytes(), contentType)
+}
+
+// save a document to "s3://<bucket>/<key>", "-" for stdout,
+// or "file://<path>" or a plain path
+func save(spec string, data []byte, contentType string) error {
+	switch {
+	case strings.HasPrefix(spec, "s3://"):
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+		if !ok || bucket == "" || key == "" {
+			return errors.Errorf("invalid s3 location '%s', expected 's3://<bucket>/<key>'", spec)
+		}
+		_, err := s3.New(CfgSession).PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(contentType),
+		})
+		return errors.Wrap(err, "error writing object")
+	case spec == "-":
+		_, err := os.Stdout.Write(data)
+		return err
+	default:
+		return errors.Wrap(os.WriteFile(strings.TrimPrefix(spec, "file://"), data, 0o600), "error writing file")
+	}
+}
+
+// newSinks selects audit trail backends from a comma-separated list:
+// "s3://<bucket>/[<prefix>]" writes S3 objects, "dynamodb:<table>" writes
+// DynamoDB items, and "file://<path>" or a plain path appends to a local file
+func newSinks(specs string) ([]app.AuditSink, error) {
+	var sinks []app.AuditSink
+
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+
+		switch {
+		case spec == "":
+			continue
+		case strings.HasPrefix(spec, "s3://"):
+			bucket, prefix, _ := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+			if bucket == "" {
+				return nil, errors.Errorf("invalid s3 audit sink '%s', expected 's3://<bucket>/<prefix>'", spec)
+			}
+			sinks = append(sinks, &app.ObjectSink{Client: s3.New(OpSession), Bucket: bucket, Prefix: prefix})
+		case strings.HasPrefix(spec, "dynamodb:"):
+			sinks = append(sinks, &app.TableSink{Client: dynamodb.New(OpSession), Table: strings.TrimPrefix(spec, "dynamodb:")})
+		default:
+			sinks = append(sinks, &app.FileSink{Path: strings.TrimPrefix(spec, "file://")})
+		}
+	}
+
+	return sinks, nil
+}
+
+func handler(ctx context.Context, event json.RawMessage) (err error) {
+	if Tracer != nil {
+		defer func() {
+			if ferr := Tracer.ForceFlush(context.Background()); ferr != nil {
+				logrus.WithError(ferr).Error("error exporting spans")
+			}
+		}()
+	}
+
+	ctx, span := otel.Tracer(app.TracerName).Start(ctx, "handler")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	log := logrus.WithContext(ctx).WithField("version", Version)
 	log.Info("starting")
 
-	config, err := app.GetConfig(SCli, Secret)
+	inv, invoked, err := app.ParseInvocation(event)
+	if err != nil {
+		log.WithError(err).Error("error parsing invocation")
+		return err
+	}
+
+	change, targeted, err := app.ParseChange(event)
+	if err != nil {
+		log.WithError(err).Error("error parsing event")
+		return err
+	}
+
+	update, updated, err := app.ParseSecretUpdate(event)
+	if err != nil {
+		log.WithError(err).Error("error parsing event")
+		return err
+	}
+
+	if updated {
+		log = log.WithField("update", update)
+
+		if !update.Targets(Sources...) {
+			log.Info("ignoring an update of another secret")
+			return nil
+		}
+
+		if update.Applied(Sources...) || Runs.Covers(update.Time) {
+			log.Info("ignoring an update already applied by a previous run")
+			return nil
+		}
+	}
+
+	started := time.Now()
+
+	if targeted {
+		log = log.WithField("change", change)
+
+		if change.Own(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")) {
+			log.Info("ignoring a change made by this application")
+			return nil
+		}
+
+		if len(change.Groups) == 0 {
+			log.Info("ignoring a change of no security group")
+			return nil
+		}
+	}
+
+	_, load := otel.Tracer(app.TracerName).Start(ctx, "LoadConfig")
+	config, err := app.LoadConfig(Sources...)
+	if err != nil {
+		load.RecordError(err)
+		load.SetStatus(codes.Error, err.Error())
+	}
+	load.End()
 	if err != nil {
 		log.WithError(err).Error("error fetching configuration")
 		return err
 	}
+	config.SetContext(ctx)
+
+	if invoked {
+		log = log.WithField("invocation", inv)
+
+		if inv.Restore != "" {
+			snapshot, err := loadSnapshot(inv.Restore)
+			if err != nil {
+				log.WithError(err).Error("error loading snapshot")
+				return err
+			}
+			config.Restore(snapshot)
+		}
+
+		if err := config.Apply(inv); err != nil {
+			log.WithError(err).Error("invalid invocation")
+			return err
+		}
+	}
+
+	report := app.NewReport(Sources...)
+	report.Change = change
+	report.Invocation = inv
+
+	report.Scheduled = config.Scheduled()
+	report.Expiring = config.Expiring()
+	for _, rule := range report.Expiring {
+		log.WithField("rule", rule.Rule).Warnf("rule expires at %s", rule.ExpiresAt.Format(time.RFC3339))
+	}
 
-	if err := config.Run(Cli); err != nil {
-		log.WithError(err).Error("config run failed")
+	if err := config.Expand(Feeds, Hosts); err != nil {
+		log.WithError(err).WithField("report", report).Error("error expanding rules")
 		return err
 	}
 
-	log.Info("finished")
+	if !targeted || !knownAccount(ctx, config, change) {
+		if err := config.Discover(organizations.New(OpSession)); err != nil {
+			log.WithError(err).WithField("report", report).Error("error discovering accounts")
+			return err
+		}
+	}
+
+	if targeted {
+		err = config.RunGroups(changeClient(config, change), change.Groups)
+		report.Skipped = config.Skipped()
+	} else if len(config.Accounts) > 0 || config.Discovery != nil {
+		report.Accounts, err = config.RunAccounts(newAccountClient)
+	} else if len(config.Regions) > 0 {
+		report.Regions, err = config.RunRegions(Cli, newRegionClient)
+	} else {
+		err = config.Run(Cli)
+		report.Skipped = config.Skipped()
+	}
+	report.Changes = config.Changes()
+
+	// account and region of runs which do not reconcile several of them
+	account, region := callerAccount(ctx), aws.StringValue(OpSession.Config.Region)
+	if targeted {
+		account, region = change.Account, change.Region
+	}
+
+	if merr := config.EmitMetrics(os.Stdout, account, region, time.Now()); merr != nil {
+		log.WithError(merr).Error("error emitting metrics")
+	}
+
+	invocation := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		invocation = lc.AwsRequestID
+	}
+	if aerr := app.Audit(Sinks, app.NewAuditRecords(report, invocation, account, region)); aerr != nil {
+		log.WithError(aerr).Error("error writing the audit trail")
+	}
+
+	// change events which needed no remediation are not worth a notification
+	if !targeted || len(report.Changes) > 0 {
+		if nerr := config.Notify(newTopicClient(config), Webhooks, report.Changes); nerr != nil {
+			log.WithError(nerr).Error("error sending notifications")
+		}
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("report", report).Error("config run failed")
+		return err
+	}
+
+	if !targeted && !invoked {
+		Runs.Done(started)
+	}
+
+	if invoked && inv.Snapshot != "" {
+		snapshot := config.Snapshot()
+		if err := saveSnapshot(inv.Snapshot, snapshot); err != nil {
+			log.WithError(err).Error("error saving snapshot")
+			return err
+		}
+		log.Infof("saved a snapshot of %d security groups to '%s'", len(snapshot.Groups), inv.Snapshot)
+	}
+
+	if invoked && inv.Compliance != "" {
+		compliance := config.Compliance()
+		format, _ := app.FormatOf(inv.Compliance, inv.ComplianceFormat)
+		if err := saveCompliance(inv.Compliance, format, compliance); err != nil {
+			log.WithError(err).Error("error saving compliance report")
+			return err
+		}
+		log.Infof("saved a %s compliance report of %d drifted out of %d protocols to '%s'", format, compliance.Drifted(), len(compliance.Groups), inv.Compliance)
+	}
+
+	log.WithField("report", report).Info("finished")
 
 	return nil
 }
 
 func main() {
+	spec := flag.String("config", os.Getenv("CONFIG_SOURCE"), "comma-separated configuration sources, merged in order: '-' for stdin, a file path, 'secret:<name>', 'ssm:<name>', 's3://<bucket>/<key>', or empty for the SECRET secret")
+	event := flag.String("event", "", "invocation payload of a local run, e.g. '{\"groups\":[\"sg-123\"],\"protocols\":[\"ssh\"],\"dry_run\":true}'")
+	audit := flag.String("audit", os.Getenv("AUDIT_SINK"), "comma-separated audit trail sinks: 's3://<bucket>/<prefix>', 'dynamodb:<table>' or a file path")
+	flag.Parse()
+
+	var err error
+	if Sources, err = newSources(*spec); err != nil {
+		logrus.WithError(err).Fatal("invalid configuration source")
+	}
+
+	if Sinks, err = newSinks(*audit); err != nil {
+		logrus.WithError(err).Fatal("invalid audit sink")
+	}
+
 	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
 		lambda.Start(handler)
 	} else {
-		if err := handler(context.Background()); err != nil {
+		if err := handler(context.Background(), json.RawMessage(*event)); err != nil {
 			logrus.WithError(err).Fatal("handler failed")
 		}
 	}
@@ -10,6 +10,13 @@ type Tag struct {
 	Value *string
 }
 
+// TagKeys contains a list of AWS Tag keys, any of which should be present,
+// and additional EC2 Filters, all of which should match
+type TagKeys struct {
+	Keys    []*string
+	Filters []*ec2.Filter
+}
+
 // SecurityGroup represents an Ingress rule
 type SecurityGroup struct {
 	ID *string
@@ -7,19 +7,34 @@ import (
 
 // GetSecurityGroups returns list of Security Groups matching a Tag (receiver)
 func (t *Tag) GetSecurityGroups(cli Client) ([]*ec2.SecurityGroup, error) {
+	return describe(cli, []*ec2.Filter{
+		{
+			Name:   t.Key,
+			Values: []*string{t.Value},
+		},
+	})
+}
+
+// GetSecurityGroups returns list of Security Groups having any of the Tag Keys (receiver)
+// and matching all of its Filters
+func (t *TagKeys) GetSecurityGroups(cli Client) ([]*ec2.SecurityGroup, error) {
+	return describe(cli, append([]*ec2.Filter{
+		{
+			Name:   aws.String("tag-key"),
+			Values: t.Keys,
+		},
+	}, t.Filters...))
+}
+
+func describe(cli Client, filters []*ec2.Filter) ([]*ec2.SecurityGroup, error) {
 	l := []*ec2.SecurityGroup{}
 	var token *string
 
 	for {
 		o, err := cli.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
 			MaxResults: aws.Int64(100),
-			Filters: []*ec2.Filter{
-				{
-					Name:   t.Key,
-					Values: []*string{t.Value},
-				},
-			},
-			NextToken: token,
+			Filters:    filters,
+			NextToken:  token,
 		})
 		if err != nil {
 			return nil, err
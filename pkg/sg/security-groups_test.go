@@ -161,3 +161,138 @@ func TestGetSecurityGroups(t *testing.T) {
 		assert.Equal(test.ExpectedOutput, result)
 	}
 }
+
+func TestGetSecurityGroupsByTagKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	type test struct {
+		Receiver       *sg.TagKeys
+		MockInput1     *ec2.DescribeSecurityGroupsInput
+		MockOutput1    *ec2.DescribeSecurityGroupsOutput
+		MockInput2     *ec2.DescribeSecurityGroupsInput
+		MockOutput2    *ec2.DescribeSecurityGroupsOutput
+		MockError      error
+		ExpectedError  string
+		ExpectedOutput []*ec2.SecurityGroup
+	}
+
+	filter := []*ec2.Filter{
+		{
+			Name:   aws.String("tag-key"),
+			Values: []*string{aws.String("http"), aws.String("ssh")},
+		},
+	}
+
+	token := aws.String("token")
+
+	suite := map[string]test{
+		"Success": {
+			Receiver: &sg.TagKeys{
+				Keys: []*string{aws.String("http"), aws.String("ssh")},
+			},
+			MockInput1: &ec2.DescribeSecurityGroupsInput{
+				MaxResults: aws.Int64(100),
+				Filters:    filter,
+			},
+			MockOutput1: &ec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []*ec2.SecurityGroup{
+					{
+						GroupId: aws.String("sg-1"),
+					},
+				},
+				NextToken: token,
+			},
+			MockInput2: &ec2.DescribeSecurityGroupsInput{
+				MaxResults: aws.Int64(100),
+				Filters:    filter,
+				NextToken:  token,
+			},
+			MockOutput2: &ec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []*ec2.SecurityGroup{
+					{
+						GroupId: aws.String("sg-2"),
+					},
+				},
+				NextToken: nil,
+			},
+			MockError:     nil,
+			ExpectedError: "",
+			ExpectedOutput: []*ec2.SecurityGroup{
+				{
+					GroupId: aws.String("sg-1"),
+				},
+				{
+					GroupId: aws.String("sg-2"),
+				},
+			},
+		},
+		"With Filters": {
+			Receiver: &sg.TagKeys{
+				Keys: []*string{aws.String("http"), aws.String("ssh")},
+				Filters: []*ec2.Filter{
+					{
+						Name:   aws.String("vpc-id"),
+						Values: []*string{aws.String("vpc-1")},
+					},
+				},
+			},
+			MockInput1: &ec2.DescribeSecurityGroupsInput{
+				MaxResults: aws.Int64(100),
+				Filters: append(filter, &ec2.Filter{
+					Name:   aws.String("vpc-id"),
+					Values: []*string{aws.String("vpc-1")},
+				}),
+			},
+			MockOutput1: &ec2.DescribeSecurityGroupsOutput{
+				SecurityGroups: []*ec2.SecurityGroup{
+					{
+						GroupId: aws.String("sg-1"),
+					},
+				},
+			},
+			MockError:     nil,
+			ExpectedError: "",
+			ExpectedOutput: []*ec2.SecurityGroup{
+				{
+					GroupId: aws.String("sg-1"),
+				},
+			},
+		},
+		"Failure": {
+			Receiver: &sg.TagKeys{
+				Keys: []*string{aws.String("http"), aws.String("ssh")},
+			},
+			MockInput1: &ec2.DescribeSecurityGroupsInput{
+				MaxResults: aws.Int64(100),
+				Filters:    filter,
+			},
+			MockOutput1:    &ec2.DescribeSecurityGroupsOutput{},
+			MockError:      errors.New("reason"),
+			ExpectedError:  "reason",
+			ExpectedOutput: nil,
+		},
+	}
+
+	var counter int
+	for name, test := range suite {
+		counter++
+		t.Logf("Test Case %v/%v - %s", counter, len(suite), name)
+
+		m := new(mocks.SG)
+
+		m.On("DescribeSecurityGroups", test.MockInput1).Return(test.MockOutput1, test.MockError).Once()
+		if test.MockInput2 != nil {
+			m.On("DescribeSecurityGroups", test.MockInput2).Return(test.MockOutput2, test.MockError).Once()
+		}
+
+		result, err := test.Receiver.GetSecurityGroups(m)
+
+		if test.ExpectedError != "" {
+			assert.EqualError(err, test.ExpectedError)
+		} else {
+			assert.Equal(nil, err)
+		}
+
+		assert.Equal(test.ExpectedOutput, result)
+	}
+}
@@ -42,9 +42,11 @@ export default $config({
     const { createFunction } = await import("./infra/lambda");
     const { createAlarms } = await import("./infra/alarms");
     const { createCron } = await import("./infra/cron");
+    const { createEvents } = await import("./infra/events");
 
     const { fn } = createFunction();
     createAlarms({ fn });
     createCron({ fn });
+    createEvents({ fn });
   },
 });